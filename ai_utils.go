@@ -8,10 +8,15 @@ import (
 	"strings"
 )
 
-// AIDiff explains git diff
-func AIDiff() (string, error) {
+// AIDiff explains git diff; without args the staged changes are explained,
+// otherwise args are passed to git diff, e.g. a range such as main..HEAD
+func AIDiff(args ...string) (string, error) {
+	if len(args) == 0 {
+		args = []string{"--cached"}
+	}
+
 	// Get git diff
-	cmd := exec.Command("git", "diff", "--cached")
+	cmd := exec.Command("git", append([]string{"diff"}, args...)...)
 	var out bytes.Buffer
 	cmd.Stdout = &out
 	err := cmd.Run()
@@ -0,0 +1,526 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/peterh/liner"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Credential sources reported by `auth status`
+const (
+	sourceEnv    = "environment"
+	sourceHelper = "credential helper"
+	sourceFile   = "credentials file"
+)
+
+const (
+	credentialsFileName = "credentials.enc"
+	credentialsKeyName  = "credentials.key"
+	passphraseEnv       = "NEUROCLI_PASSPHRASE"
+	pbkdf2Iterations    = 600000
+)
+
+// configDir returns the directory holding NeuroCLI's state (~/.config/neurocli on Linux)
+func configDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate config directory: %v", err)
+	}
+	return filepath.Join(dir, "neurocli"), nil
+}
+
+// resolveAPIKey finds the API key for a provider, checking the environment,
+// the configured credential helper and the encrypted credentials file in turn
+func resolveAPIKey(p Provider) (key, source string, err error) {
+	for _, name := range []string{p.KeyEnv, "NEUROCLI_API_KEY"} {
+		if name == "" {
+			continue
+		}
+		if key = strings.TrimSpace(os.Getenv(name)); key != "" {
+			registerSecret(key)
+			return key, sourceEnv, nil
+		}
+	}
+
+	if helper := viper.GetString("credential_helper"); helper != "" {
+		values, err := runCredentialHelper(helper, "get", map[string]string{"provider": p.Name})
+		if err != nil {
+			return "", "", err
+		}
+		if key = strings.TrimSpace(values["key"]); key != "" {
+			registerSecret(key)
+			return key, sourceHelper, nil
+		}
+	}
+
+	creds, err := loadCredentials()
+	if err != nil {
+		return "", "", err
+	}
+	if key = creds[p.Name]; key != "" {
+		registerSecret(key)
+		return key, sourceFile, nil
+	}
+
+	return "", "", nil
+}
+
+// keyFromHelper reports whether resolveAPIKey would run the credential
+// helper to find the provider's key
+func keyFromHelper(p Provider) bool {
+	for _, name := range []string{p.KeyEnv, "NEUROCLI_API_KEY"} {
+		if name != "" && strings.TrimSpace(os.Getenv(name)) != "" {
+			return false
+		}
+	}
+	return viper.GetString("credential_helper") != ""
+}
+
+// storeAPIKey saves a key with the credential helper if one is configured,
+// otherwise in the encrypted credentials file
+func storeAPIKey(p Provider, key string) (string, error) {
+	registerSecret(key)
+
+	if helper := viper.GetString("credential_helper"); helper != "" {
+		_, err := runCredentialHelper(helper, "store", map[string]string{"provider": p.Name, "key": key})
+		return sourceHelper, err
+	}
+
+	creds, err := loadCredentials()
+	if err != nil {
+		return "", err
+	}
+	creds[p.Name] = key
+	return sourceFile, saveCredentials(creds)
+}
+
+// eraseAPIKey removes a provider's key from the credential helper and the credentials file
+func eraseAPIKey(p Provider) error {
+	if helper := viper.GetString("credential_helper"); helper != "" {
+		if _, err := runCredentialHelper(helper, "erase", map[string]string{"provider": p.Name}); err != nil {
+			return err
+		}
+	}
+
+	creds, err := loadCredentials()
+	if err != nil {
+		return err
+	}
+	if _, ok := creds[p.Name]; !ok {
+		return nil
+	}
+	delete(creds, p.Name)
+	return saveCredentials(creds)
+}
+
+// runCredentialHelper speaks a git-style credential helper protocol: the helper
+// is invoked with the action (get, store or erase) as its last argument and
+// receives key=value lines on stdin, terminated by a blank line. For `get` it
+// answers with key=value lines on stdout, of which `key` holds the API key.
+//
+// A helper starting with '!' is run through the shell, a bare name is
+// expanded to the neurocli-credential-<name> executable on PATH.
+func runCredentialHelper(helper, action string, values map[string]string) (map[string]string, error) {
+	var cmd *exec.Cmd
+	switch {
+	case strings.HasPrefix(helper, "!"):
+		script := strings.TrimSpace(helper[1:]) + " " + action
+		if runtime.GOOS == "windows" {
+			cmd = exec.Command("cmd", "/C", script)
+		} else {
+			cmd = exec.Command("sh", "-c", script)
+		}
+	default:
+		fields := strings.Fields(helper)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("empty credential helper")
+		}
+		if !strings.ContainsAny(fields[0], `/\`) {
+			fields[0] = "neurocli-credential-" + fields[0]
+		}
+		cmd = exec.Command(fields[0], append(fields[1:], action)...)
+	}
+
+	var in bytes.Buffer
+	for _, k := range []string{"provider", "key"} {
+		if v, ok := values[k]; ok {
+			fmt.Fprintf(&in, "%s=%s\n", k, v)
+		}
+	}
+	in.WriteString("\n")
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = &in
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("credential helper %q failed on %s: %v: %s",
+			helper, action, err, redactSecrets(strings.TrimSpace(stderr.String())))
+	}
+
+	result := make(map[string]string)
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			break
+		}
+		if k, v, ok := strings.Cut(line, "="); ok {
+			result[k] = v
+		}
+	}
+	return result, nil
+}
+
+// credentialFile is the on-disk layout of the encrypted credentials store
+type credentialFile struct {
+	KDF   string `json:"kdf"`
+	Salt  []byte `json:"salt,omitempty"`
+	Nonce []byte `json:"nonce"`
+	Data  []byte `json:"data"`
+}
+
+// loadCredentials decrypts the credentials file into a provider -> key map
+func loadCredentials() (map[string]string, error) {
+	creds := make(map[string]string)
+
+	dir, err := configDir()
+	if err != nil {
+		return nil, err
+	}
+	raw, err := os.ReadFile(filepath.Join(dir, credentialsFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return creds, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials: %v", err)
+	}
+
+	var file credentialFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("corrupt credentials file: %v", err)
+	}
+
+	key, err := credentialsKey(dir, file.KDF, file.Salt)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, file.Nonce, file.Data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt credentials (wrong passphrase?)")
+	}
+
+	if err := json.Unmarshal(plain, &creds); err != nil {
+		return nil, fmt.Errorf("corrupt credentials file: %v", err)
+	}
+	for _, key := range creds {
+		registerSecret(key)
+	}
+	return creds, nil
+}
+
+// saveCredentials encrypts the provider -> key map with AES-GCM and writes it
+func saveCredentials(creds map[string]string) error {
+	dir, err := configDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %v", err)
+	}
+
+	file := credentialFile{KDF: "keyfile"}
+	if os.Getenv(passphraseEnv) != "" {
+		file.KDF = "pbkdf2"
+		file.Salt = make([]byte, 16)
+		if _, err := rand.Read(file.Salt); err != nil {
+			return err
+		}
+	}
+
+	key, err := credentialsKey(dir, file.KDF, file.Salt)
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+
+	plain, err := json.Marshal(creds)
+	if err != nil {
+		return err
+	}
+	file.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return err
+	}
+	file.Data = gcm.Seal(nil, file.Nonce, plain, nil)
+
+	raw, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, credentialsFileName), raw, 0600); err != nil {
+		return fmt.Errorf("failed to write credentials: %v", err)
+	}
+	return nil
+}
+
+// credentialsKey derives the file encryption key, either from NEUROCLI_PASSPHRASE
+// or from a random key stored next to the credentials with 0600 permissions.
+// The random key is only created while there is no credentials file yet.
+func credentialsKey(dir, kdf string, salt []byte) ([]byte, error) {
+	switch kdf {
+	case "pbkdf2":
+		passphrase := os.Getenv(passphraseEnv)
+		if passphrase == "" {
+			return nil, fmt.Errorf("credentials file is passphrase protected; set %s", passphraseEnv)
+		}
+		return pbkdf2.Key(sha256.New, passphrase, salt, pbkdf2Iterations, 32)
+	case "keyfile", "":
+		path := filepath.Join(dir, credentialsKeyName)
+		key, err := os.ReadFile(path)
+		if err == nil && len(key) == 32 {
+			return key, nil
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read credentials key: %v", err)
+		}
+		// A new key would make existing credentials undecryptable for good
+		if _, statErr := os.Stat(filepath.Join(dir, credentialsFileName)); statErr == nil {
+			if err != nil {
+				return nil, fmt.Errorf("credentials key %s is missing; restore it or remove %s to start over", path, credentialsFileName)
+			}
+			return nil, fmt.Errorf("credentials key %s is corrupt; restore it or remove %s to start over", path, credentialsFileName)
+		}
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, fmt.Errorf("failed to create config directory: %v", err)
+		}
+		if err := os.WriteFile(path, key, 0600); err != nil {
+			return nil, fmt.Errorf("failed to write credentials key: %v", err)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported credentials key derivation %q", kdf)
+	}
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+var (
+	secretsMu    sync.Mutex
+	knownSecrets []string
+)
+
+// registerSecret remembers a credential so it can be scrubbed from output
+func registerSecret(secret string) {
+	if len(secret) < 8 {
+		return
+	}
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	for _, s := range knownSecrets {
+		if s == secret {
+			return
+		}
+	}
+	knownSecrets = append(knownSecrets, secret)
+}
+
+// registeredSecrets returns a copy of the credentials registered so far
+func registeredSecrets() []string {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	return append([]string(nil), knownSecrets...)
+}
+
+// redactSecrets replaces every known credential in s with a placeholder
+func redactSecrets(s string) string {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	for _, secret := range knownSecrets {
+		s = strings.ReplaceAll(s, secret, "[REDACTED]")
+	}
+	return s
+}
+
+// redactError scrubs known credentials from an error message
+func redactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := redactSecrets(err.Error())
+	if msg == err.Error() {
+		return err
+	}
+	return errors.New(msg)
+}
+
+// maskSecret shows just enough of a key to tell keys apart
+func maskSecret(secret string) string {
+	if len(secret) < 12 {
+		return strings.Repeat("*", len(secret))
+	}
+	return secret[:4] + strings.Repeat("*", 8) + secret[len(secret)-4:]
+}
+
+func newAuthCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "auth",
+		Short: "Manage API keys for AI providers",
+		Long: `Manage API keys for AI providers.
+
+Keys are resolved in this order:
+  1. The provider's environment variable (e.g. OPENAI_API_KEY) or NEUROCLI_API_KEY
+  2. The credential helper set with 'credential_helper' in the config file
+  3. The encrypted credentials file in the NeuroCLI config directory
+
+The credentials file is encrypted with a random key stored next to it, or with
+a key derived from NEUROCLI_PASSPHRASE when that variable is set.
+
+Credential helpers follow git's protocol: the helper is called with 'get',
+'store' or 'erase' and reads "provider=NAME" (and "key=VALUE" for store) lines
+from stdin. For 'get' it prints "key=VALUE". A helper named "pass" runs the
+neurocli-credential-pass executable; prefix a value with '!' to run it through
+the shell instead.`,
+	}
+
+	cmd.AddCommand(newAuthLoginCmd())
+	cmd.AddCommand(newAuthLogoutCmd())
+	cmd.AddCommand(newAuthStatusCmd())
+	return cmd
+}
+
+func newAuthLoginCmd() *cobra.Command {
+	var withToken bool
+
+	cmd := &cobra.Command{
+		Use:   "login",
+		Short: "Store an API key for the selected provider",
+		Example: `  # Prompt for an OpenAI key
+  neurocli auth login --provider openai
+
+  # Read the key from stdin
+  pass show openai | neurocli auth login --provider openai --with-token`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, err := activeProvider()
+			if err != nil {
+				return err
+			}
+
+			var key string
+			if withToken {
+				data, err := io.ReadAll(os.Stdin)
+				if err != nil {
+					return fmt.Errorf("failed to read key from stdin: %v", err)
+				}
+				key = string(data)
+			} else {
+				line := liner.NewLiner()
+				key, err = line.PasswordPrompt(fmt.Sprintf("API key for %s: ", p.Name))
+				line.Close()
+				if err != nil {
+					return fmt.Errorf("failed to read key: %v", err)
+				}
+			}
+
+			key = strings.TrimSpace(key)
+			if key == "" {
+				return fmt.Errorf("no API key given")
+			}
+
+			source, err := storeAPIKey(p, key)
+			if err != nil {
+				return redactError(err)
+			}
+			pterm.Success.Printf("Stored API key for %s in the %s\n", pterm.Cyan(p.Name), source)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&withToken, "with-token", false, "Read the API key from standard input")
+	return cmd
+}
+
+func newAuthLogoutCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "logout",
+		Short: "Remove the stored API key for the selected provider",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, err := activeProvider()
+			if err != nil {
+				return err
+			}
+			if err := eraseAPIKey(p); err != nil {
+				return redactError(err)
+			}
+			pterm.Success.Printf("Removed stored API key for %s\n", pterm.Cyan(p.Name))
+			if p.KeyEnv != "" && os.Getenv(p.KeyEnv) != "" {
+				pterm.Warning.Printf("%s is still set in the environment\n", p.KeyEnv)
+			}
+			return nil
+		},
+	}
+}
+
+func newAuthStatusCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Show which providers have an API key configured",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data := pterm.TableData{{"PROVIDER", "SOURCE", "KEY"}}
+			for _, name := range providerNames() {
+				p := providers[name]
+				key, source, err := resolveAPIKey(p)
+				switch {
+				case err != nil:
+					data = append(data, []string{name, "error", redactSecrets(err.Error())})
+				case key == "" && p.KeyRequired:
+					data = append(data, []string{name, "-", pterm.Red("not logged in")})
+				case key == "":
+					data = append(data, []string{name, "-", "not required"})
+				default:
+					data = append(data, []string{name, source, maskSecret(key)})
+				}
+			}
+			return pterm.DefaultTable.WithHasHeader().WithData(data).Render()
+		},
+	}
+}
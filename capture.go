@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/x/ansi"
+	"github.com/pterm/pterm"
+)
+
+// maxCapturedOutput is how much of a command's output is kept for @last
+const maxCapturedOutput = 64 * 1024
+
+// maxContextOutput is how much captured output is sent to the AI; the end
+// of the output is kept since that is where errors usually are
+const maxContextOutput = 12000
+
+// interactivePrograms take over the terminal and break when their output is
+// captured, so they are run without capture
+var interactivePrograms = map[string]bool{
+	"vi": true, "vim": true, "nvim": true, "nano": true, "emacs": true, "less": true,
+	"more": true, "man": true, "top": true, "htop": true, "watch": true, "ssh": true,
+	"tmux": true, "screen": true, "fzf": true,
+}
+
+// pipeToAIPattern matches a trailing "| ai QUESTION" on a ! command
+var pipeToAIPattern = regexp.MustCompile(`\|\s*ai(?:\s+([\s\S]*))?$`)
+
+// capturedRun is the output of the last ! command run in the shell
+type capturedRun struct {
+	Command  string
+	Output   string
+	ExitCode int
+}
+
+// lastRun is what @last refers to; nil until a command has run
+var lastRun *capturedRun
+
+// tailBuffer is a writer that keeps the last limit bytes written to it. It
+// is safe for concurrent use, as os/exec copies stdout and stderr from
+// separate goroutines.
+type tailBuffer struct {
+	mu        sync.Mutex
+	data      []byte
+	limit     int
+	truncated bool
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.data = append(b.data, p...)
+	if over := len(b.data) - b.limit; over > 0 {
+		b.data = b.data[over:]
+		b.truncated = true
+	}
+	return len(p), nil
+}
+
+// executeCaptured runs a command while teeing its output into lastRun, so
+// the output is shown live and can be handed to the AI afterwards.
+// Interactive programs are run without capturing their output.
+func executeCaptured(display, command string) error {
+	name, _, _ := strings.Cut(strings.TrimSpace(display), " ")
+	if interactivePrograms[name] {
+		err := recordExitStatus(executeCommand(command))
+		lastRun = &capturedRun{Command: display, ExitCode: lastExitStatus}
+		return err
+	}
+
+	out := &tailBuffer{limit: maxCapturedOutput}
+	cmd := shellCommand(command)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = io.MultiWriter(os.Stdout, out)
+	cmd.Stderr = io.MultiWriter(os.Stderr, out)
+	err := recordExitStatus(runCommand(cmd))
+
+	output := ansi.Strip(string(out.data))
+	if out.truncated {
+		// Drop the partial line the buffer was cut in
+		if i := strings.IndexByte(output, '\n'); i >= 0 {
+			output = output[i+1:]
+		}
+	}
+	lastRun = &capturedRun{Command: display, Output: output, ExitCode: lastExitStatus}
+	writeTranscript("%s\nExit status: %d\n\n", fenced(output), lastExitStatus)
+	return err
+}
+
+// splitPipeToAI splits "cmd | ai question" into the command and the
+// question. ok is false when the command isn't piped to the AI.
+func splitPipeToAI(command string) (string, string, bool) {
+	loc := pipeToAIPattern.FindStringSubmatchIndex(command)
+	if loc == nil {
+		return command, "", false
+	}
+	question := ""
+	if loc[2] >= 0 {
+		question = strings.TrimSpace(command[loc[2]:loc[3]])
+	}
+	if question == "" {
+		question = "Explain this output."
+	}
+	return strings.TrimSpace(command[:loc[0]]), question, true
+}
+
+// withLastRun replaces @last in a prompt with a reference to the previous
+// command and appends that command's output
+func withLastRun(prompt string) (string, error) {
+	if !strings.Contains(prompt, "@last") {
+		return prompt, nil
+	}
+	if lastRun == nil {
+		return "", fmt.Errorf("@last refers to the previous ! command, but none has run yet")
+	}
+	prompt = strings.ReplaceAll(prompt, "@last", "the output of the last command")
+	return prompt + "\n\n" + lastRun.context(), nil
+}
+
+// context formats a captured run for inclusion in a prompt
+func (r *capturedRun) context() string {
+	output := r.Output
+	if len(output) > maxContextOutput {
+		output = strings.ToValidUTF8(output[len(output)-maxContextOutput:], "")
+		output = "[... earlier output omitted ...]\n" + output
+	}
+	return fmt.Sprintf("Command: %s\nExit status: %d\nOutput:\n%s", r.Command, r.ExitCode, fenced(strings.TrimRight(output, "\n")))
+}
+
+// handleLast shows what @last currently refers to
+func handleLast(args []string) error {
+	if lastRun == nil {
+		pterm.Info.Println("No command has run yet")
+		return nil
+	}
+	pterm.Info.Printf("%s (exit status %d, %d bytes of output)\n", pterm.Cyan(lastRun.Command), lastRun.ExitCode, len(lastRun.Output))
+	fmt.Println(lastRun.Output)
+	return nil
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	// modelCacheTTL is how long a provider's model list is reused before it
+	// is fetched again
+	modelCacheTTL = 24 * time.Hour
+	// modelRetryDelay is how long a failed fetch is not retried, so an
+	// unreachable endpoint doesn't hold up every completion
+	modelRetryDelay = 10 * time.Minute
+)
+
+// modelList is a provider's models as cached on disk
+type modelList struct {
+	Fetched time.Time `json:"fetched"`
+	Failed  time.Time `json:"failed,omitempty"`
+	Models  []string  `json:"models"`
+}
+
+func newCompletionCmd() *cobra.Command {
+	var noDescriptions bool
+
+	cmd := &cobra.Command{
+		Use:   "completion [bash|zsh|fish|powershell]",
+		Short: "Generate the shell completion script",
+		Long: `Print the completion script for your shell. Besides commands and flags it
+completes providers, models (fetched from the provider and cached for a day),
+personas, languages, redaction modes, git refs for ai-diff ranges and the
+flag values of custom command templates.
+
+Bash (needs the bash-completion package):
+  source <(neurocli completion bash)                # current session
+  neurocli completion bash > ~/.local/share/bash-completion/completions/neurocli
+
+Zsh:
+  neurocli completion zsh > "${fpath[1]}/_neurocli"
+  # compinit must be enabled: autoload -U compinit; compinit
+
+Fish:
+  neurocli completion fish > ~/.config/fish/completions/neurocli.fish
+
+PowerShell:
+  neurocli completion powershell | Out-String | Invoke-Expression
+  # add this line to $PROFILE to load it in every session
+
+Start a new shell after installing the script.`,
+		Args:      cobra.MaximumNArgs(1),
+		ValidArgs: []string{"bash", "zsh", "fish", "powershell"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return cmd.Help()
+			}
+			root := cmd.Root()
+			switch args[0] {
+			case "bash":
+				return root.GenBashCompletionV2(os.Stdout, !noDescriptions)
+			case "zsh":
+				if noDescriptions {
+					return root.GenZshCompletionNoDesc(os.Stdout)
+				}
+				return root.GenZshCompletion(os.Stdout)
+			case "fish":
+				return root.GenFishCompletion(os.Stdout, !noDescriptions)
+			case "powershell":
+				if noDescriptions {
+					return root.GenPowerShellCompletion(os.Stdout)
+				}
+				return root.GenPowerShellCompletionWithDesc(os.Stdout)
+			}
+			return fmt.Errorf("unsupported shell %q (supported: bash, zsh, fish, powershell)", args[0])
+		},
+	}
+
+	cmd.Flags().BoolVar(&noDescriptions, "no-descriptions", false, "leave out completion descriptions")
+	return cmd
+}
+
+// registerGlobalCompletions adds completions for the root command's
+// persistent flags
+func registerGlobalCompletions(root *cobra.Command) {
+	root.RegisterFlagCompletionFunc("provider", cobra.FixedCompletions(providerNames(), cobra.ShellCompDirectiveNoFileComp))
+	root.RegisterFlagCompletionFunc("model", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return completeModels(nil, toComplete), cobra.ShellCompDirectiveNoFileComp
+	})
+	root.RegisterFlagCompletionFunc("persona", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return personaNames(), cobra.ShellCompDirectiveNoFileComp
+	})
+	root.RegisterFlagCompletionFunc("redact", cobra.FixedCompletions([]string{"mask", "strict", "off"}, cobra.ShellCompDirectiveNoFileComp))
+	root.RegisterFlagCompletionFunc("system", cobra.NoFileCompletions)
+	root.RegisterFlagCompletionFunc("config", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"yaml", "yml"}, cobra.ShellCompDirectiveFilterFileExt
+	})
+}
+
+// completeGitRange completes a git revision or range such as main..HEAD,
+// for ai-diff
+func completeGitRange(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	// Complete the end of main.. or main... as a ref of its own
+	head, word := "", toComplete
+	if i := strings.LastIndex(toComplete, ".."); i >= 0 {
+		head, word = toComplete[:i+2], toComplete[i+2:]
+	}
+	var c []string
+	for _, ref := range append(completeGitRefs(word), gitHeadRefs(word)...) {
+		c = append(c, head+ref)
+	}
+	return c, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+}
+
+// gitHeadRefs returns HEAD-relative revisions starting with prefix
+func gitHeadRefs(prefix string) []string {
+	var c []string
+	for _, ref := range []string{"HEAD", "HEAD~1", "HEAD~2", "HEAD~3", "ORIG_HEAD"} {
+		if strings.HasPrefix(ref, prefix) {
+			c = append(c, ref)
+		}
+	}
+	return c
+}
+
+// completeModels lists the active provider's models starting with word.
+// It is used for --model and the shell's /model built-in.
+func completeModels(args []string, word string) []string {
+	if len(args) > 0 {
+		return nil
+	}
+	p, err := activeProvider()
+	if err != nil {
+		return nil
+	}
+	models, _ := providerModels(p)
+	if !slices.Contains(models, p.DefaultModel) {
+		models = append(models, p.DefaultModel)
+	}
+	return completeFrom(models, args, word)
+}
+
+// modelCachePath returns the file a provider's model list is cached in
+func modelCachePath(p Provider) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "neurocli", "models", p.Name+".json"), nil
+}
+
+// providerModels returns the models a provider offers, from the cache when
+// it is fresh and from the provider's models endpoint otherwise. A stale
+// cache is still used when the endpoint can't be reached, and the endpoint
+// isn't tried again for a while.
+func providerModels(p Provider) ([]string, error) {
+	path, err := modelCachePath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var cached modelList
+	if data, err := os.ReadFile(path); err == nil && json.Unmarshal(data, &cached) == nil {
+		if time.Since(cached.Fetched) < modelCacheTTL || time.Since(cached.Failed) < modelRetryDelay {
+			return cached.Models, nil
+		}
+	}
+
+	// A credential helper may ask for a password or take long, which a
+	// completion can't wait for
+	if keyFromHelper(p) && p.KeyRequired {
+		return cached.Models, fmt.Errorf("not listing %s models: the key comes from the credential helper", p.Name)
+	}
+
+	list := modelList{Fetched: time.Now()}
+	list.Models, err = fetchModels(p, !keyFromHelper(p))
+	if err != nil {
+		list = modelList{Fetched: cached.Fetched, Failed: time.Now(), Models: cached.Models}
+	}
+	if data, err := json.Marshal(list); err == nil && os.MkdirAll(filepath.Dir(path), 0700) == nil {
+		os.WriteFile(path, data, 0600)
+	}
+	return list.Models, err
+}
+
+// fetchModels asks a provider's models endpoint which models it offers,
+// sending the provider's key if withKey is set
+func fetchModels(p Provider, withKey bool) ([]string, error) {
+	if p.ModelsURL == "" {
+		return nil, fmt.Errorf("%s does not list its models", p.Name)
+	}
+	apiKey := ""
+	if withKey {
+		var err error
+		if apiKey, _, err = resolveAPIKey(p); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, p.ModelsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, redactError(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("listing %s models failed with status %d", p.Name, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if err != nil {
+		return nil, err
+	}
+	return parseModelList(body)
+}
+
+// parseModelList reads the model ids from a models response: the OpenAI
+// format {"data": [{"id": ...}]}, or a plain list of names or of objects with
+// a name, as Pollinations returns
+func parseModelList(body []byte) ([]string, error) {
+	type model struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	var entries []model
+
+	var wrapped struct {
+		Data []model `json:"data"`
+	}
+	var names []string
+	switch {
+	case json.Unmarshal(body, &wrapped) == nil && wrapped.Data != nil:
+		entries = wrapped.Data
+	case json.Unmarshal(body, &entries) == nil:
+	case json.Unmarshal(body, &names) == nil:
+	default:
+		return nil, errors.New("unrecognized models response")
+	}
+
+	for _, e := range entries {
+		if e.ID != "" {
+			names = append(names, e.ID)
+		} else if e.Name != "" {
+			names = append(names, e.Name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
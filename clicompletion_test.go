@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestParseModelList(t *testing.T) {
+	tests := []struct {
+		body string
+		want []string
+	}{
+		{`{"data": [{"id": "gpt-4o"}, {"id": "gpt-4o-mini"}]}`, []string{"gpt-4o", "gpt-4o-mini"}},
+		{`[{"name": "openai"}, {"name": "mistral"}, {"id": "llama"}]`, []string{"llama", "mistral", "openai"}},
+		{`["b", "a"]`, []string{"a", "b"}},
+		{`[]`, nil},
+	}
+	for _, tt := range tests {
+		got, err := parseModelList([]byte(tt.body))
+		if err != nil {
+			t.Errorf("%s: %v", tt.body, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseModelList(%s) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{`{"error": "nope"}`, `not json`, `42`} {
+		if _, err := parseModelList([]byte(bad)); err == nil {
+			t.Errorf("%s: no error", bad)
+		}
+	}
+}
+
+// testModelsServer counts the requests made to a models endpoint that
+// answers with status
+func testModelsServer(t *testing.T, status int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(status)
+		w.Write([]byte(`{"data": [{"id": "m1"}]}`))
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	return server, &hits
+}
+
+func TestProviderModelsCachesFailures(t *testing.T) {
+	server, hits := testModelsServer(t, http.StatusBadGateway)
+	p := Provider{Name: "test", ModelsURL: server.URL}
+
+	for i := 0; i < 3; i++ {
+		providerModels(p)
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("endpoint asked %d times, want 1", n)
+	}
+}
+
+func TestProviderModelsCachesList(t *testing.T) {
+	server, hits := testModelsServer(t, http.StatusOK)
+	p := Provider{Name: "test", ModelsURL: server.URL}
+
+	for i := 0; i < 2; i++ {
+		models, err := providerModels(p)
+		if err != nil || !reflect.DeepEqual(models, []string{"m1"}) {
+			t.Fatalf("got %q, %v", models, err)
+		}
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("endpoint asked %d times, want 1", n)
+	}
+}
+
+func TestProviderModelsSkipsCredentialHelper(t *testing.T) {
+	server, hits := testModelsServer(t, http.StatusOK)
+	defer viper.Set("credential_helper", viper.GetString("credential_helper"))
+	viper.Set("credential_helper", "neurocli-test-helper-that-does-not-exist")
+	t.Setenv("NEUROCLI_API_KEY", "")
+
+	p := Provider{Name: "test", ModelsURL: server.URL, KeyRequired: true}
+	if _, err := providerModels(p); err == nil {
+		t.Error("no error for a key from the credential helper")
+	}
+	if n := hits.Load(); n != 0 {
+		t.Errorf("endpoint asked %d times, want 0", n)
+	}
+
+	// Providers that work without a key are asked without one
+	p.KeyRequired = false
+	if models, err := providerModels(p); err != nil || len(models) != 1 {
+		t.Errorf("keyless provider: got %q, %v", models, err)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"strings"
+)
+
+// codeBlock is a fenced code block found in a Markdown response
+type codeBlock struct {
+	Lang string
+	Code string
+}
+
+// markdownSegment is either prose or a code block, in response order
+type markdownSegment struct {
+	Text  string
+	Block *codeBlock
+}
+
+// splitMarkdown splits a Markdown document into prose and fenced code blocks.
+// Fences may use backticks or tildes, be indented up to three spaces and are
+// closed by a fence of the same character at least as long. An unclosed
+// block runs to the end of the document, which happens when a response is
+// cut off.
+func splitMarkdown(markdown string) []markdownSegment {
+	var segments []markdownSegment
+	var text strings.Builder
+
+	lines := strings.Split(strings.ReplaceAll(markdown, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		fence, info, ok := openingFence(lines[i])
+		if !ok {
+			text.WriteString(lines[i])
+			if i < len(lines)-1 {
+				text.WriteByte('\n')
+			}
+			continue
+		}
+
+		if text.Len() > 0 {
+			segments = append(segments, markdownSegment{Text: text.String()})
+			text.Reset()
+		}
+
+		var code []string
+		j := i + 1
+		for ; j < len(lines); j++ {
+			if isClosingFence(lines[j], fence) {
+				break
+			}
+			code = append(code, lines[j])
+		}
+
+		lang := ""
+		if fields := strings.Fields(info); len(fields) > 0 {
+			lang = strings.ToLower(strings.Trim(fields[0], "{}."))
+		}
+		segments = append(segments, markdownSegment{Block: &codeBlock{
+			Lang: lang,
+			Code: strings.Join(code, "\n"),
+		}})
+		i = j
+	}
+
+	if text.Len() > 0 {
+		segments = append(segments, markdownSegment{Text: text.String()})
+	}
+	return segments
+}
+
+// openingFence reports whether line opens a code block, returning the fence
+// and the info string after it
+func openingFence(line string) (string, string, bool) {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 || len(trimmed) < 3 {
+		return "", "", false
+	}
+	ch := trimmed[0]
+	if ch != '`' && ch != '~' {
+		return "", "", false
+	}
+	n := 0
+	for n < len(trimmed) && trimmed[n] == ch {
+		n++
+	}
+	if n < 3 {
+		return "", "", false
+	}
+	info := trimmed[n:]
+	if ch == '`' && strings.Contains(info, "`") {
+		return "", "", false
+	}
+	return trimmed[:n], strings.TrimSpace(info), true
+}
+
+// isClosingFence reports whether line closes a block opened with fence
+func isClosingFence(line, fence string) bool {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 {
+		return false
+	}
+	trimmed = strings.TrimRight(trimmed, " \t")
+	return len(trimmed) >= len(fence) && strings.Trim(trimmed, fence[:1]) == ""
+}
+
+// extractCodeBlocks returns every fenced code block in a Markdown document
+func extractCodeBlocks(markdown string) []codeBlock {
+	var blocks []codeBlock
+	for _, s := range splitMarkdown(markdown) {
+		if s.Block != nil {
+			blocks = append(blocks, *s.Block)
+		}
+	}
+	return blocks
+}
+
+// sameLanguage reports whether a fence tag denotes the requested language
+func sameLanguage(tag, language string) bool {
+	a, okA := lookupLanguage(tag)
+	b, okB := lookupLanguage(language)
+	if okA && okB {
+		return a == b
+	}
+	return strings.EqualFold(tag, language)
+}
+
+// extractCode pulls the code for language out of a model response. Blocks
+// tagged with the language are preferred, then untagged blocks, then any
+// block; several candidates are joined in order. A response without fences
+// is taken to be code already.
+func extractCode(response, language string) string {
+	blocks := extractCodeBlocks(response)
+	if len(blocks) == 0 {
+		return strings.TrimSpace(response)
+	}
+
+	var tagged, untagged []string
+	for _, b := range blocks {
+		switch {
+		case language != "" && sameLanguage(b.Lang, language):
+			tagged = append(tagged, b.Code)
+		case b.Lang == "":
+			untagged = append(untagged, b.Code)
+		}
+	}
+
+	candidates := tagged
+	if len(candidates) == 0 {
+		candidates = untagged
+	}
+	if len(candidates) == 0 {
+		for _, b := range blocks {
+			candidates = append(candidates, b.Code)
+		}
+	}
+	return strings.Trim(strings.Join(candidates, "\n\n"), "\n")
+}
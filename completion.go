@@ -0,0 +1,210 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// gitRefCommands are git subcommands whose arguments are usually refs
+var gitRefCommands = map[string]bool{
+	"checkout": true, "switch": true, "merge": true, "rebase": true, "diff": true,
+	"log": true, "show": true, "branch": true, "reset": true, "cherry-pick": true,
+	"revert": true, "tag": true, "push": true, "pull": true,
+}
+
+// completeShellLine is the liner word completer for the interactive shell.
+// The word under the cursor is completed depending on what precedes it.
+func completeShellLine(line string, pos int) (string, []string, string) {
+	before, tail := line[:pos], line[pos:]
+	start := strings.LastIndexAny(before, " \t") + 1
+	head, word := before[:start], before[start:]
+	fields := strings.Fields(head)
+
+	// ! runs a system command: executables first, then git refs or paths
+	if strings.HasPrefix(before, "!") {
+		args := strings.Fields(strings.TrimPrefix(head, "!"))
+		switch {
+		case start == 0:
+			return "!", completeExecutables(word[1:]), tail
+		case len(args) == 0:
+			return head, completeExecutables(word), tail
+		case args[0] == "git" && len(args) >= 2 && gitRefCommands[args[1]] && !strings.HasPrefix(word, "-"):
+			return head, append(completeGitRefs(word), completePaths(word, false)...), tail
+		}
+		return head, completePaths(word, false), tail
+	}
+
+	// First word: built-ins, slash built-ins and earlier prompts
+	if len(fields) == 0 {
+		slash := ""
+		if strings.HasPrefix(word, "/") {
+			slash = "/"
+		}
+		name := strings.ToLower(strings.TrimPrefix(word, slash))
+		var c []string
+		for _, cmd := range shellCommands {
+			for _, n := range append([]string{cmd.Name}, cmd.Aliases...) {
+				if strings.HasPrefix(n, name) && (slash != "" || !cmd.SlashOnly) && len(n) > 1 {
+					c = append(c, slash+n)
+				}
+			}
+		}
+		if slash == "" {
+			for _, h := range completeHistory(before) {
+				if !slices.Contains(c, h) {
+					c = append(c, h)
+				}
+			}
+		}
+		return head, c, tail
+	}
+
+	// Arguments of a built-in use its own completer
+	if cmd, ok := lookupShellCommand(strings.TrimPrefix(fields[0], "/")); ok {
+		if cmd.Complete == nil {
+			return head, nil, tail
+		}
+		return head, cmd.Complete(fields[1:], word), tail
+	}
+
+	// Anything else is a prompt for the AI
+	return "", completeHistory(before), tail
+}
+
+// completeHistory returns earlier prompts starting with prefix, newest first
+func completeHistory(prefix string) []string {
+	var c []string
+	history := promptHistory.texts("")
+	for i := len(history) - 1; i >= 0; i-- {
+		if h := history[i]; h != prefix && strings.HasPrefix(h, prefix) {
+			c = append(c, h)
+		}
+	}
+	return c
+}
+
+// completePaths lists files and directories starting with word; directories
+// get a trailing slash so completion can continue into them
+func completePaths(word string, dirsOnly bool) []string {
+	dir, base := filepath.Split(word)
+	readDir := dir
+	if readDir == "" {
+		readDir = "."
+	} else if strings.HasPrefix(readDir, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			readDir = filepath.Join(home, readDir[2:])
+		}
+	}
+
+	entries, err := os.ReadDir(readDir)
+	if err != nil {
+		return nil
+	}
+	var c []string
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, base) || strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".") {
+			continue
+		}
+		isDir := e.IsDir()
+		if e.Type()&os.ModeSymlink != 0 {
+			if info, err := os.Stat(filepath.Join(readDir, name)); err == nil {
+				isDir = info.IsDir()
+			}
+		}
+		switch {
+		case isDir:
+			c = append(c, dir+name+"/")
+		case !dirsOnly:
+			c = append(c, dir+name)
+		}
+	}
+	return c
+}
+
+// pathExecutables lists the executables on PATH, read once per session
+var pathExecutables = sync.OnceValue(func() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			name := e.Name()
+			if seen[name] || e.IsDir() {
+				continue
+			}
+			if runtime.GOOS == "windows" {
+				name = strings.TrimSuffix(name, filepath.Ext(name))
+			} else if info, err := e.Info(); err != nil || info.Mode()&0111 == 0 && info.Mode()&os.ModeSymlink == 0 {
+				continue
+			}
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+})
+
+// completeExecutables returns executables on PATH starting with prefix,
+// or paths when prefix names a file directly
+func completeExecutables(prefix string) []string {
+	if strings.ContainsRune(prefix, '/') {
+		return completePaths(prefix, false)
+	}
+	var c []string
+	for _, name := range pathExecutables() {
+		if strings.HasPrefix(name, prefix) {
+			c = append(c, name)
+		}
+	}
+	return c
+}
+
+// completeGitRefs returns branches, remote branches and tags starting with prefix
+func completeGitRefs(prefix string) []string {
+	out, err := exec.Command("git", "for-each-ref", "--format=%(refname:short)", "refs/heads", "refs/remotes", "refs/tags").Output()
+	if err != nil {
+		return nil
+	}
+	var c []string
+	for _, ref := range strings.Fields(string(out)) {
+		if strings.HasPrefix(ref, prefix) {
+			c = append(c, ref)
+		}
+	}
+	return c
+}
+
+// completeDirs completes the directory argument of cd
+func completeDirs(args []string, word string) []string {
+	if len(args) > 0 {
+		return nil
+	}
+	return completePaths(word, true)
+}
+
+// completeBlockNumbers completes the code block number of copy, save and run,
+// and the target path of save
+func completeBlockNumbers(args []string, word string) []string {
+	if len(args) > 0 {
+		return completePaths(word, false)
+	}
+	var c []string
+	for i := range lastCodeBlocks {
+		if n := strconv.Itoa(i + 1); strings.HasPrefix(n, word) {
+			c = append(c, n)
+		}
+	}
+	return c
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// editPrompt asks for search/replace blocks against the given files
+const editPrompt = `Edit the files below according to this instruction:
+
+"%s"
+
+%s
+Respond ONLY with search/replace blocks in exactly this format, one block per change:
+
+path/to/file
+<<<<<<< SEARCH
+exact lines copied from the current file
+=======
+the lines that replace them
+>>>>>>> REPLACE
+
+Rules:
+- The path must be one of the file paths shown above
+- The SEARCH part must match the current file exactly, including whitespace and indentation
+- Include enough lines in SEARCH to match exactly one place in the file
+- Keep blocks small; use several blocks for changes in different places
+- Do not include explanations`
+
+func newEditCmd() *cobra.Command {
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:   "edit FILE... INSTRUCTION",
+		Short: "Edit existing files with AI-generated patches",
+		Long: `Send one or more files to the AI together with an instruction and apply the
+changes it proposes. The patch is checked to apply cleanly and shown as a
+colored diff before anything is written. Every applied edit is recorded in
+the undo journal; run 'neurocli undo' to revert it.`,
+		Example: `  neurocli edit main.go "add a --verbose flag that enables debug logging"
+  neurocli edit handler.go handler_test.go "rename Handle to ServeHTTP"`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			files := args[:len(args)-1]
+			instruction := args[len(args)-1]
+
+			originals := make(map[string]string, len(files))
+			var listing strings.Builder
+			for _, path := range files {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					return fmt.Errorf("failed to read %s: %w", path, err)
+				}
+				originals[path] = string(data)
+				fmt.Fprintf(&listing, "File: %s\n```\n%s\n```\n\n", path, strings.TrimSuffix(string(data), "\n"))
+			}
+
+			pterm.Info.Printf("Asking for changes to %s...\n", pterm.Cyan(strings.Join(files, ", ")))
+			response, err := askAI(fmt.Sprintf(editPrompt, instruction, listing.String()))
+			if err != nil {
+				return fmt.Errorf("failed to get edit: %w", err)
+			}
+
+			patches, err := parsePatches(response)
+			if err != nil {
+				return err
+			}
+
+			changes := make(map[string]string)
+			for _, p := range patches {
+				path, err := matchEditTarget(p.Path, files)
+				if err != nil {
+					return err
+				}
+				current, ok := changes[path]
+				if !ok {
+					current = originals[path]
+				}
+				updated, err := applyPatch(current, p)
+				if err != nil {
+					return fmt.Errorf("patch does not apply cleanly: %w", err)
+				}
+				changes[path] = updated
+			}
+
+			changed := 0
+			for _, path := range files {
+				updated, ok := changes[path]
+				if !ok || updated == originals[path] {
+					delete(changes, path)
+					continue
+				}
+				changed++
+				fmt.Println(colorizeDiff(unifiedDiff("a/"+path, "b/"+path, originals[path], updated)))
+			}
+			if changed == 0 {
+				pterm.Info.Println("The AI proposed no changes")
+				return nil
+			}
+
+			if !yes {
+				ok, err := confirm(fmt.Sprintf("Apply changes to %d file(s)?", changed))
+				if err != nil {
+					return err
+				}
+				if !ok {
+					pterm.Info.Println("Discarded changes")
+					return nil
+				}
+			}
+
+			if err := writeWithJournal("edit: "+instruction, changes); err != nil {
+				return err
+			}
+			pterm.Success.Printf("✓ Updated %d file(s); run 'neurocli undo' to revert\n", changed)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Apply the changes without asking")
+	return cmd
+}
+
+// matchEditTarget maps a path named by the model back to one of the files
+// given on the command line
+func matchEditTarget(path string, files []string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(strings.TrimPrefix(path, "b/")))
+	for _, f := range files {
+		if filepath.Clean(f) == clean {
+			return f, nil
+		}
+	}
+
+	var byBase []string
+	for _, f := range files {
+		if filepath.Base(f) == filepath.Base(clean) {
+			byBase = append(byBase, f)
+		}
+	}
+	if len(byBase) == 1 {
+		return byBase[0], nil
+	}
+	return "", fmt.Errorf("the AI tried to edit %q, which is not one of the given files", path)
+}
+
+// confirm asks a yes/no question, refusing when there is no terminal to ask
+// on. With --yes on run every question is answered yes.
+func confirm(question string) (bool, error) {
+	if assumeYes {
+		return true, nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false, fmt.Errorf("cannot ask for confirmation without a terminal; pass --yes to proceed")
+	}
+	return pterm.DefaultInteractiveConfirm.Show(question)
+}
@@ -0,0 +1,598 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/x/ansi"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// explainPrompt asks for the meaning of each token of a command line
+const explainPrompt = `Explain this shell command:
+
+%s
+
+It was split into these numbered tokens:
+%s
+%s
+Return ONLY a JSON object, with no surrounding text or code fences, in exactly this format:
+{"summary": "one or two sentences on what the whole command does", "meanings": ["meaning of token 1", "meaning of token 2"], "warnings": ["anything destructive, irreversible or surprising"]}
+
+Give exactly one meaning per token, in order. For a flag that takes the
+following token as its value, say so. Leave "warnings" empty when there is
+nothing to warn about.`
+
+// maxDocsPerProgram is how much of a man page or --help output is sent
+// along for each program
+const maxDocsPerProgram = 6000
+
+// Token kinds of a parsed command line
+const (
+	tokenProgram    = "program"
+	tokenFlag       = "flag"
+	tokenArgument   = "argument"
+	tokenOperator   = "operator"
+	tokenRedirect   = "redirect"
+	tokenAssignment = "assignment"
+)
+
+// commandToken is one word or operator of a command line
+type commandToken struct {
+	Text    string
+	Value   string
+	Kind    string
+	Program string
+}
+
+// wrapperProgram is a program that runs the command following its own
+// options and arguments
+type wrapperProgram struct {
+	// valueOptions take the next word as their value, as in sudo -u root
+	valueOptions []string
+	// arguments come before the command, such as the duration of timeout
+	arguments int
+}
+
+// wrapperPrograms run the command that follows them
+var wrapperPrograms = map[string]wrapperProgram{
+	"sudo": {valueOptions: []string{"-u", "-g", "-h", "-p", "-C", "-D", "-r", "-t", "-U", "-T",
+		"--user", "--group", "--host", "--prompt", "--close-from", "--chdir", "--role", "--type", "--other-user", "--command-timeout"}},
+	"doas":    {valueOptions: []string{"-u", "-C"}},
+	"env":     {valueOptions: []string{"-u", "-C", "-S", "--unset", "--chdir", "--split-string"}},
+	"nohup":   {},
+	"time":    {valueOptions: []string{"-f", "-o", "--format", "--output"}},
+	"nice":    {valueOptions: []string{"-n", "--adjustment"}},
+	"ionice":  {valueOptions: []string{"-c", "-n", "--class", "--classdata"}},
+	"stdbuf":  {valueOptions: []string{"-i", "-o", "-e", "--input", "--output", "--error"}},
+	"timeout": {valueOptions: []string{"-s", "-k", "--signal", "--kill-after"}, arguments: 1},
+	"xargs": {valueOptions: []string{"-a", "-d", "-E", "-I", "-L", "-n", "-P", "-s",
+		"--arg-file", "--delimiter", "--max-lines", "--max-args", "--max-procs", "--max-chars", "--process-slot-var"}},
+	"exec":    {valueOptions: []string{"-a"}},
+	"command": {},
+	"watch":   {valueOptions: []string{"-n", "-q", "--interval", "--equexit"}},
+}
+
+// commandOperators are recognized longest first
+var commandOperators = []string{"2>&1", "&>>", "2>>", "&&", "||", ">>", "&>", "2>", "|", "&", ";", ">", "<"}
+
+// assignmentPattern matches the variable name of a NAME=value word
+var assignmentPattern = regexp.MustCompile(`^[A-Za-z_]\w*$`)
+
+// overstrikePattern matches the backspace bold and underline of raw man output
+var overstrikePattern = regexp.MustCompile(".\x08")
+
+func newExplainCmd() *cobra.Command {
+	var noDocs, runHelp bool
+
+	cmd := &cobra.Command{
+		Use:   "explain COMMAND",
+		Short: "Explain a shell command piece by piece",
+		Long: `Split a shell command into programs, flags, arguments, operators and
+redirections, and explain each of them. The man page of each program is sent
+along so the explanation matches the installed version. With --run-help,
+programs without a man page are run with --help instead; only use it for
+programs you trust to print help rather than do their work. Destructive
+flags are flagged locally, whatever the AI says.`,
+		Example: `  neurocli explain "tar -xzvf x.tgz -C /opt --strip-components=1"
+  neurocli explain "find . -name '*.tmp' -delete"`,
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: cobra.NoFileCompletions,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			line := strings.Join(args, " ")
+			tokens, err := parseCommandLine(line)
+			if err != nil {
+				return err
+			}
+
+			docs := ""
+			if !noDocs {
+				docs = commandDocs(tokens, runHelp)
+			}
+			response, err := askAI(fmt.Sprintf(explainPrompt, line, numberedTokens(tokens), docs))
+			if err != nil {
+				return fmt.Errorf("failed to get an explanation: %w", err)
+			}
+			explanation, err := parseExplanation(response)
+			if err != nil {
+				return err
+			}
+
+			printExplanation(tokens, explanation, destructiveWarnings(tokens))
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&noDocs, "no-docs", false, "don't send man pages or --help output along")
+	cmd.Flags().BoolVar(&runHelp, "run-help", false, "run programs without a man page with --help for their documentation")
+	return cmd
+}
+
+// parseCommandLine splits a command line into tokens, honoring quotes, and
+// classifies each one. Operators start a new command, so the first word
+// after them is a program again.
+func parseCommandLine(line string) ([]commandToken, error) {
+	var tokens []commandToken
+	var raw, value strings.Builder
+	var quote rune
+	escaped, inWord := false, false
+
+	flush := func() {
+		if inWord {
+			tokens = append(tokens, commandToken{Text: raw.String(), Value: value.String()})
+			raw.Reset()
+			value.Reset()
+			inWord = false
+		}
+	}
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case escaped:
+			raw.WriteRune(r)
+			value.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			raw.WriteRune(r)
+			escaped, inWord = true, true
+		case quote != 0:
+			raw.WriteRune(r)
+			if r == quote {
+				quote = 0
+			} else {
+				value.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			raw.WriteRune(r)
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			flush()
+		default:
+			op := matchOperator(string(runes[i:]))
+			// 2> only counts as a redirection at the start of a word
+			if op != "" && !(inWord && strings.HasPrefix(op, "2")) {
+				flush()
+				tokens = append(tokens, commandToken{Text: op, Value: op, Kind: tokenOperator})
+				i += len([]rune(op)) - 1
+				continue
+			}
+			raw.WriteRune(r)
+			value.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	flush()
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+	return classifyTokens(tokens), nil
+}
+
+// matchOperator returns the operator at the start of s, if any
+func matchOperator(s string) string {
+	for _, op := range commandOperators {
+		if strings.HasPrefix(s, op) {
+			return op
+		}
+	}
+	return ""
+}
+
+// classifyTokens sets the kind of each word and the program it belongs to,
+// and merges redirections with their target
+func classifyTokens(tokens []commandToken) []commandToken {
+	var out []commandToken
+	program, wantProgram, endOfFlags := "", true, false
+	// A wrapper's options and arguments come before the program it runs
+	var wrapper *wrapperProgram
+	wantValue, arguments := false, 0
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		switch {
+		case t.Kind == tokenOperator && isRedirect(t.Text):
+			t.Kind = tokenRedirect
+			if t.Text != "2>&1" && i+1 < len(tokens) && tokens[i+1].Kind == "" {
+				i++
+				t.Text += " " + tokens[i].Text
+				t.Value = tokens[i].Value
+			}
+		case t.Kind == tokenOperator:
+			program, wantProgram, endOfFlags = "", true, false
+			wrapper, wantValue, arguments = nil, false, 0
+		case wantValue:
+			t.Kind = tokenArgument
+			wantValue = false
+		case wrapper != nil && !endOfFlags && t.Value == "--":
+			t.Kind = tokenFlag
+			endOfFlags = true
+		case wrapper != nil && !endOfFlags && len(t.Value) > 1 && strings.HasPrefix(t.Value, "-"):
+			t.Kind = tokenFlag
+			wantValue = slices.Contains(wrapper.valueOptions, t.Value)
+		case wrapper != nil && arguments > 0:
+			t.Kind = tokenArgument
+			arguments--
+		case wantProgram && isAssignment(t.Value):
+			t.Kind = tokenAssignment
+		case wantProgram:
+			t.Kind = tokenProgram
+			program, endOfFlags = t.Value, false
+			wrapper, wantValue, arguments = nil, false, 0
+			if w, ok := wrapperPrograms[filepath.Base(program)]; ok {
+				wrapper, arguments = &w, w.arguments
+			}
+			wantProgram = wrapper != nil
+		case !endOfFlags && t.Value == "--":
+			t.Kind = tokenFlag
+			endOfFlags = true
+		case !endOfFlags && len(t.Value) > 1 && strings.HasPrefix(t.Value, "-"):
+			t.Kind = tokenFlag
+		default:
+			t.Kind = tokenArgument
+		}
+		t.Program = program
+		out = append(out, t)
+	}
+	return out
+}
+
+// isRedirect reports whether an operator redirects input or output
+func isRedirect(op string) bool {
+	return strings.ContainsAny(op, "<>")
+}
+
+// isAssignment reports whether a word is a NAME=value variable assignment
+func isAssignment(word string) bool {
+	name, _, ok := strings.Cut(word, "=")
+	return ok && assignmentPattern.MatchString(name)
+}
+
+// numberedTokens lists the tokens for the prompt
+func numberedTokens(tokens []commandToken) string {
+	var b strings.Builder
+	for i, t := range tokens {
+		fmt.Fprintf(&b, "%d. %s (%s)\n", i+1, t.Text, t.Kind)
+	}
+	return b.String()
+}
+
+// commandDocs collects the parts of each program's man page or --help output
+// that mention the flags used, as grounding for the explanation
+func commandDocs(tokens []commandToken, runHelp bool) string {
+	flags := make(map[string][]string)
+	var programs []string
+	for _, t := range tokens {
+		switch t.Kind {
+		case tokenProgram:
+			if _, seen := flags[t.Value]; !seen {
+				programs = append(programs, t.Value)
+				flags[t.Value] = []string{}
+			}
+		case tokenFlag:
+			flags[t.Program] = append(flags[t.Program], t.Value)
+		}
+	}
+
+	var b strings.Builder
+	for _, program := range programs {
+		text := programDocs(program, runHelp)
+		if text == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "\nDocumentation excerpt for %s on this system:\n%s\n", program, fenced(docExcerpt(text, flags[program])))
+	}
+	return b.String()
+}
+
+// programDocs returns the man page of a program, or with runHelp its --help
+// output when it has none. Programs that aren't installed and paths, such as
+// ./deploy.sh, are skipped: many scripts ignore --help and just run.
+func programDocs(program string, runHelp bool) string {
+	if strings.ContainsRune(program, '/') {
+		return ""
+	}
+	path, err := exec.LookPath(program)
+	if err != nil {
+		return ""
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	man := exec.CommandContext(ctx, "man", program)
+	man.Env = append(os.Environ(), "MANPAGER=cat", "PAGER=cat", "MANWIDTH=100")
+	if out, err := man.Output(); err == nil && len(out) > 0 {
+		return overstrikePattern.ReplaceAllString(string(out), "")
+	}
+	if !runHelp {
+		return ""
+	}
+
+	// --help runs the program itself, so it gets no input and an empty
+	// working directory
+	help := exec.CommandContext(ctx, path, "--help")
+	help.Dir = os.TempDir()
+	out, _ := help.CombinedOutput()
+	return string(out)
+}
+
+// docExcerpt keeps the start of a man page plus the lines around each
+// mention of the given flags. Combined short flags such as -xzvf are also
+// looked up letter by letter.
+func docExcerpt(text string, flags []string) string {
+	lines := strings.Split(text, "\n")
+	keep := make([]bool, len(lines))
+	for i := 0; i < len(lines) && i < 8; i++ {
+		keep[i] = true
+	}
+
+	var names []string
+	for _, f := range flags {
+		name, _, _ := strings.Cut(f, "=")
+		names = append(names, name)
+		if !strings.HasPrefix(name, "--") && len(name) > 2 {
+			for _, c := range name[1:] {
+				names = append(names, "-"+string(c))
+			}
+		}
+	}
+	for _, name := range names {
+		pattern := regexp.MustCompile(`(^|[\s,\[])` + regexp.QuoteMeta(name) + `\b`)
+		for i, l := range lines {
+			if pattern.MatchString(l) {
+				for j := i; j < len(lines) && j <= i+3; j++ {
+					keep[j] = true
+				}
+			}
+		}
+	}
+
+	var b strings.Builder
+	gap := false
+	for i, l := range lines {
+		if !keep[i] {
+			gap = true
+			continue
+		}
+		if gap && b.Len() > 0 {
+			b.WriteString("...\n")
+		}
+		gap = false
+		b.WriteString(strings.TrimRight(l, " ") + "\n")
+		if b.Len() > maxDocsPerProgram {
+			break
+		}
+	}
+	return b.String()
+}
+
+// commandExplanation is the model's answer for neurocli explain
+type commandExplanation struct {
+	Summary  string   `json:"summary"`
+	Meanings []string `json:"meanings"`
+	Warnings []string `json:"warnings"`
+}
+
+// parseExplanation extracts the JSON answer from a model response
+func parseExplanation(response string) (*commandExplanation, error) {
+	start := strings.Index(response, "{")
+	end := strings.LastIndex(response, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("response does not contain a JSON answer")
+	}
+	var e commandExplanation
+	if err := json.Unmarshal([]byte(response[start:end+1]), &e); err != nil {
+		return nil, fmt.Errorf("invalid explanation: %v", err)
+	}
+	return &e, nil
+}
+
+// destructiveWarnings flags options known to delete, overwrite or escalate,
+// independently of the model
+func destructiveWarnings(tokens []commandToken) []string {
+	var warnings []string
+	args := make(map[int][]commandToken)
+	var starts []int
+	for i, t := range tokens {
+		switch t.Kind {
+		case tokenProgram:
+			starts = append(starts, i)
+		case tokenFlag, tokenArgument:
+			if len(starts) > 0 {
+				start := starts[len(starts)-1]
+				args[start] = append(args[start], t)
+			}
+		case tokenRedirect:
+			op := strings.Fields(t.Text)[0]
+			if (op == ">" || op == "&>" || op == "2>") && !strings.HasPrefix(t.Value, "/dev/") {
+				warnings = append(warnings, fmt.Sprintf("%s overwrites %s", op, t.Value))
+			}
+		case tokenOperator:
+			if t.Text == "|" && len(starts) > 0 && i+1 < len(tokens) {
+				from, to := tokens[starts[len(starts)-1]].Value, tokens[i+1].Value
+				if (from == "curl" || from == "wget") && (to == "sh" || to == "bash" || to == "zsh" || to == "sudo") {
+					warnings = append(warnings, "piping a download into a shell runs whatever the server sends")
+				}
+			}
+		}
+	}
+
+	for _, start := range starts {
+		program := filepath.Base(tokens[start].Value)
+		a := args[start]
+		has := func(flags ...string) bool {
+			for _, t := range a {
+				for _, f := range flags {
+					if t.Value == f || shortFlagSet(t.Value, f) || strings.HasPrefix(t.Value, f+"=") {
+						return true
+					}
+				}
+			}
+			return false
+		}
+		// arg returns the i-th non-flag argument
+		arg := func(i int) string {
+			n := 0
+			for _, t := range a {
+				if t.Kind == tokenArgument {
+					if n == i {
+						return t.Value
+					}
+					n++
+				}
+			}
+			return ""
+		}
+
+		switch program {
+		case "sudo", "doas":
+			warnings = append(warnings, program+" runs the command as root")
+		case "rm":
+			if has("-r", "-R", "--recursive") {
+				warnings = append(warnings, "rm -r deletes directories and everything in them")
+			}
+			if has("-f", "--force") {
+				warnings = append(warnings, "rm -f deletes without asking, even write-protected files")
+			}
+			for _, t := range a {
+				if t.Kind == tokenArgument && (t.Value == "/" || t.Value == "~" || t.Value == "*" || t.Value == "/*") {
+					warnings = append(warnings, fmt.Sprintf("rm %s deletes far more than usually intended", t.Value))
+				}
+			}
+		case "shred":
+			warnings = append(warnings, "shred overwrites files so they cannot be recovered")
+		case "dd":
+			for _, t := range a {
+				if strings.HasPrefix(t.Value, "of=") {
+					warnings = append(warnings, fmt.Sprintf("dd %s overwrites the target, which may be a whole disk", t.Value))
+				}
+			}
+		case "mkfs", "fdisk", "parted", "wipefs", "sgdisk":
+			warnings = append(warnings, program+" changes disk partitions or file systems and destroys their data")
+		case "chmod", "chown", "chgrp":
+			if has("-R", "--recursive") {
+				warnings = append(warnings, program+" -R changes every file below the directory")
+			}
+		case "find":
+			if has("-delete") {
+				warnings = append(warnings, "find -delete deletes every match")
+			}
+			for i, t := range a {
+				if (t.Value == "-exec" || t.Value == "-execdir") && i+1 < len(a) && (a[i+1].Value == "rm" || a[i+1].Value == "shred") {
+					warnings = append(warnings, fmt.Sprintf("find %s %s deletes every match", t.Value, a[i+1].Value))
+				}
+			}
+		case "kill", "pkill", "killall":
+			if has("-9", "-KILL", "-SIGKILL") {
+				warnings = append(warnings, program+" -9 kills without letting the process clean up")
+			}
+		case "truncate":
+			warnings = append(warnings, "truncate cuts off file contents")
+		case "tar":
+			// Old-style tar takes bundled flags without a dash: tar xzf x.tgz
+			bundled := len(a) > 0 && a[0].Kind == tokenArgument && strings.ContainsRune(a[0].Value, 'x') && assignmentPattern.MatchString(a[0].Value)
+			if has("-x", "--extract", "--get") || bundled {
+				warnings = append(warnings, "tar extraction overwrites existing files with the same names")
+			}
+		case "git":
+			switch arg(0) {
+			case "push":
+				if has("-f", "--force", "--force-with-lease") {
+					warnings = append(warnings, "git push --force rewrites the remote branch's history")
+				}
+			case "reset":
+				if has("--hard") {
+					warnings = append(warnings, "git reset --hard discards uncommitted changes")
+				}
+			case "clean":
+				if has("-f", "--force") {
+					warnings = append(warnings, "git clean -f deletes untracked files")
+				}
+			case "branch":
+				if has("-D") {
+					warnings = append(warnings, "git branch -D deletes the branch even if it isn't merged")
+				}
+			case "checkout", "restore":
+				for _, t := range a {
+					if t.Value == "." {
+						warnings = append(warnings, "git "+arg(0)+" . discards changes to every file")
+						break
+					}
+				}
+			}
+		}
+	}
+	return warnings
+}
+
+// shortFlagSet reports whether a combined short flag such as -rf sets flag
+func shortFlagSet(token, flag string) bool {
+	if len(flag) != 2 || flag[0] != '-' || strings.HasPrefix(token, "--") || len(token) < 2 || token[0] != '-' {
+		return false
+	}
+	return strings.ContainsRune(token[1:], rune(flag[1]))
+}
+
+// printExplanation shows the summary, a table of tokens with their meaning
+// and all warnings
+func printExplanation(tokens []commandToken, e *commandExplanation, local []string) {
+	if e.Summary != "" {
+		fmt.Println(e.Summary)
+		fmt.Println()
+	}
+
+	t := newShellTable("TOKEN", "KIND", "MEANING")
+	for i, tok := range tokens {
+		meaning := ""
+		if i < len(e.Meanings) {
+			meaning = e.Meanings[i]
+		}
+		t.Row(tok.Text, tok.Kind, meaning)
+	}
+	rendered := t.Render()
+	if width := terminalWidth(); ansi.StringWidth(strings.SplitN(rendered, "\n", 2)[0]) > width {
+		rendered = t.Width(width).Render()
+	}
+	fmt.Println(rendered)
+
+	seen := make(map[string]bool)
+	for _, w := range append(local, e.Warnings...) {
+		if w = strings.TrimSpace(w); w != "" && !seen[w] {
+			seen[w] = true
+			pterm.Warning.Println(w)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCommandLine(t *testing.T) {
+	tests := []struct {
+		line  string
+		kinds []string
+	}{
+		{"ls -la", []string{"program", "flag"}},
+		{`grep "a b" file.txt`, []string{"program", "argument", "argument"}},
+		{"a && b || c; d", []string{"program", "operator", "program", "operator", "program", "operator", "program"}},
+		{"go test ./... 2>&1 | tee out.log", []string{"program", "argument", "argument", "redirect", "operator", "program", "argument"}},
+		{"echo hi > out.txt", []string{"program", "argument", "redirect"}},
+		{"FOO=1 make build", []string{"assignment", "program", "argument"}},
+		{"git commit -- -file", []string{"program", "argument", "flag", "argument"}},
+	}
+	for _, tt := range tests {
+		tokens, err := parseCommandLine(tt.line)
+		if err != nil {
+			t.Errorf("%s: %v", tt.line, err)
+			continue
+		}
+		var kinds []string
+		for _, tok := range tokens {
+			kinds = append(kinds, tok.Kind)
+		}
+		if !reflect.DeepEqual(kinds, tt.kinds) {
+			t.Errorf("%s: kinds %v, want %v", tt.line, kinds, tt.kinds)
+		}
+	}
+
+	if _, err := parseCommandLine(`echo "open`); err == nil {
+		t.Error("unterminated quote: no error")
+	}
+}
+
+func TestClassifyTokensWrappers(t *testing.T) {
+	tests := []struct {
+		line     string
+		programs []string
+	}{
+		{"sudo rm -rf /", []string{"sudo", "rm"}},
+		{"sudo -u root rm -rf /", []string{"sudo", "rm"}},
+		{"sudo --user=root rm -rf /", []string{"sudo", "rm"}},
+		{"sudo -E -u root -- rm -rf /", []string{"sudo", "rm"}},
+		{"nice -n 10 rm -rf ~", []string{"nice", "rm"}},
+		{"xargs -0 rm -rf", []string{"xargs", "rm"}},
+		{"xargs -I {} -P 4 rm -rf {}", []string{"xargs", "rm"}},
+		{"timeout 5 rm -rf /tmp/x", []string{"timeout", "rm"}},
+		{"timeout -s KILL 5s rm -rf /tmp/x", []string{"timeout", "rm"}},
+		{"env -i rm -rf ~", []string{"env", "rm"}},
+		{"env -u HOME A=1 rm -rf ~", []string{"env", "rm"}},
+		{"sudo nice -n 5 rm -rf /", []string{"sudo", "nice", "rm"}},
+		{"find . | xargs -n 1 rm", []string{"find", "xargs", "rm"}},
+	}
+	for _, tt := range tests {
+		tokens, err := parseCommandLine(tt.line)
+		if err != nil {
+			t.Errorf("%s: %v", tt.line, err)
+			continue
+		}
+		var programs []string
+		for _, tok := range tokens {
+			if tok.Kind == tokenProgram {
+				programs = append(programs, tok.Value)
+			}
+		}
+		if !reflect.DeepEqual(programs, tt.programs) {
+			t.Errorf("%s: programs %v, want %v", tt.line, programs, tt.programs)
+		}
+	}
+}
+
+func TestDestructiveWarnings(t *testing.T) {
+	tests := []struct {
+		line string
+		want string // a warning containing this, or "" for none
+	}{
+		{"ls -la", ""},
+		{"rm file.txt", ""},
+		{"rm -rf build", "rm -r"},
+		{"sudo -u root rm -rf /", "rm -r"},
+		{"nice -n 10 rm -rf ~", "rm ~"},
+		{"xargs -0 rm -rf", "rm -r"},
+		{"timeout 5 rm -rf /", "rm /"},
+		{"env -i rm -rf ~", "rm -r"},
+		{"find . -name '*.tmp' -delete", "find -delete"},
+		{"find . -exec rm {} +", "find -exec rm"},
+		{"echo hi > notes.txt", "> overwrites notes.txt"},
+		{"echo hi >> notes.txt", ""},
+		{"make 2>/dev/null", ""},
+		{"git push --force origin main", "git push --force"},
+		{"git push origin main", ""},
+		{"tar -xzvf x.tgz", "tar extraction"},
+		{"tar xzf x.tgz", "tar extraction"},
+		{"tar czf xylophone.tgz dir", ""},
+		{"curl -fsSL https://example.com/install.sh | sh", "piping a download"},
+		{"dd if=x.img of=/dev/sda", "dd of=/dev/sda"},
+	}
+	for _, tt := range tests {
+		tokens, err := parseCommandLine(tt.line)
+		if err != nil {
+			t.Errorf("%s: %v", tt.line, err)
+			continue
+		}
+		warnings := destructiveWarnings(tokens)
+		if tt.want == "" {
+			if len(warnings) > 0 {
+				t.Errorf("%s: unexpected warnings %q", tt.line, warnings)
+			}
+			continue
+		}
+		found := false
+		for _, w := range warnings {
+			if strings.Contains(w, tt.want) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%s: warnings %q, want one containing %q", tt.line, warnings, tt.want)
+		}
+	}
+}
+
+func TestShortFlagSet(t *testing.T) {
+	tests := []struct {
+		token, flag string
+		want        bool
+	}{
+		{"-rf", "-r", true},
+		{"-rf", "-f", true},
+		{"-la", "-r", false},
+		{"--force", "-f", false},
+		{"-f", "-f", true},
+	}
+	for _, tt := range tests {
+		if got := shortFlagSet(tt.token, tt.flag); got != tt.want {
+			t.Errorf("shortFlagSet(%q, %q) = %v, want %v", tt.token, tt.flag, got, tt.want)
+		}
+	}
+}
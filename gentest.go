@@ -0,0 +1,669 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// genTestPrompt asks for tests of extracted source code
+const genTestPrompt = `Write unit tests for the following %s code from %s.
+
+%s
+Code under test:
+
+%s
+%s
+Requirements:
+- Use table-driven tests where there are several cases
+- Cover normal cases, edge cases and error paths
+- Use only the standard test framework of the project shown below, or the language default
+- Match the style of the existing tests if any are shown
+%s
+Return only the test code without any explanations.`
+
+// testTarget is the source a gen-test run is about
+type testTarget struct {
+	File     string
+	Func     string
+	Language string
+	Package  string
+	Source   string
+	Context  string
+	TestFile string
+}
+
+func newGenTestCmd() *cobra.Command {
+	var attempts int
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:   "gen-test FILE[:FUNC]",
+		Short: "Generate unit tests for existing code",
+		Long: `Generate unit tests for a file or a single function in it. For Go the
+function and the types it uses are extracted with go/ast; for Python and
+JavaScript simple heuristics are used. The tests are written to the matching
+test file, run, and regenerated with the failure output until they pass or
+--max-attempts is reached. The first tests are shown before they run and need
+confirmation unless --yes is given.`,
+		Example: `  neurocli gen-test internal/parser/parser.go:ParseHeader
+  neurocli gen-test utils.py:slugify`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target, err := loadTestTarget(args[0])
+			if err != nil {
+				return err
+			}
+
+			existing, err := os.ReadFile(target.TestFile)
+			if err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to read %s: %w", target.TestFile, err)
+			}
+			hadTestFile := err == nil
+
+			style := testStyleExample(target)
+			notes := ""
+			if target.Language == "Go" {
+				notes = fmt.Sprintf("- The tests go in package %s\n", target.Package)
+				if names := goTestNames(string(existing)); len(names) > 0 {
+					notes += fmt.Sprintf("- Do not redeclare these existing tests: %s\n", strings.Join(names, ", "))
+				}
+			}
+
+			what := target.File
+			if target.Func != "" {
+				what = target.Func + " in " + target.File
+			}
+			prompt := fmt.Sprintf(genTestPrompt, target.Language, what, target.Context, fenced(target.Source), style, notes)
+
+			// Attempts write the test file in place; put the original back
+			// however the command ends, so only the journaled write remains
+			mode := os.FileMode(0644)
+			if info, err := os.Stat(target.TestFile); err == nil {
+				mode = info.Mode().Perm()
+			}
+			var mu sync.Mutex
+			written := false
+			write := func(content string) error {
+				mu.Lock()
+				defer mu.Unlock()
+				written = true
+				if err := os.WriteFile(target.TestFile, []byte(content), mode); err != nil {
+					return fmt.Errorf("failed to write %s: %w", target.TestFile, err)
+				}
+				return nil
+			}
+			restore := func() error {
+				mu.Lock()
+				defer mu.Unlock()
+				if !written {
+					return nil
+				}
+				written = false
+				var err error
+				if hadTestFile {
+					if err = os.WriteFile(target.TestFile, existing, mode); err == nil {
+						err = os.Chmod(target.TestFile, mode)
+					}
+				} else {
+					err = os.Remove(target.TestFile)
+				}
+				if err != nil && !os.IsNotExist(err) {
+					return fmt.Errorf("failed to restore %s: %w", target.TestFile, err)
+				}
+				return nil
+			}
+			defer restore()
+
+			// Ctrl-C exits without running deferred functions
+			interrupts := make(chan os.Signal, 1)
+			signal.Notify(interrupts, os.Interrupt)
+			defer signal.Stop(interrupts)
+			finished := make(chan struct{})
+			defer close(finished)
+			go func() {
+				select {
+				case <-interrupts:
+					if err := restore(); err != nil {
+						pterm.Error.Println(err)
+					}
+					os.Exit(130)
+				case <-finished:
+				}
+			}()
+
+			var content, output string
+			passed, approved := false, yes
+			for attempt := 1; attempt <= attempts; attempt++ {
+				pterm.Info.Printf("Generating tests for %s (attempt %d/%d)...\n", pterm.Cyan(what), attempt, attempts)
+				response, err := askAI(prompt)
+				if err != nil {
+					return fmt.Errorf("failed to generate tests: %w", err)
+				}
+
+				generated := extractCode(response, target.Language)
+				content, err = mergeTestFile(target, string(existing), generated)
+				if err != nil {
+					output = err.Error()
+				} else {
+					// The tests are code from the model; look at them before
+					// they run for the first time
+					if !approved {
+						fmt.Print(renderMarkdown("```"+strings.ToLower(target.Language)+"\n"+strings.TrimRight(generated, "\n")+"\n```\n", false))
+						ok, err := confirm("Run these tests? Later attempts run without asking")
+						if err != nil {
+							return err
+						}
+						if !ok {
+							return fmt.Errorf("generated tests were not run")
+						}
+						approved = true
+					}
+					if err := write(content); err != nil {
+						return err
+					}
+					output, passed = runTargetTests(target, generated)
+				}
+				if passed {
+					break
+				}
+
+				pterm.Warning.Printf("Tests failed (attempt %d/%d):\n%s\n", attempt, attempts, output)
+				prompt = fmt.Sprintf(genTestPrompt, target.Language, what, target.Context, fenced(target.Source), style,
+					notes+"- A previous attempt failed with the output below; fix the tests (not the code under test) unless the failure reveals a real bug\n\nPrevious tests:\n"+
+						fenced(generated)+"\nOutput:\n"+fenced(output))
+			}
+
+			// Restore the original and write the final version through the undo journal
+			if err := restore(); err != nil {
+				return err
+			}
+			if content == "" {
+				return fmt.Errorf("could not produce a valid test file: %s", output)
+			}
+
+			if !passed && !yes {
+				ok, err := confirm("The generated tests still fail. Keep them anyway?")
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return fmt.Errorf("discarded failing tests after %d attempts", attempts)
+				}
+			}
+
+			if err := writeWithJournal("gen-test: "+what, map[string]string{target.TestFile: content}); err != nil {
+				return err
+			}
+			if !passed {
+				return fmt.Errorf("tests in %s still fail after %d attempts; they may have found a bug", target.TestFile, attempts)
+			}
+			pterm.Success.Printf("✓ Tests pass and were written to %s\n", pterm.Green(target.TestFile))
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&attempts, "max-attempts", 3, "Maximum number of generate-and-run attempts")
+	cmd.RegisterFlagCompletionFunc("max-attempts", cobra.NoFileCompletions)
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Run generated tests without asking and keep them even if they still fail")
+	return cmd
+}
+
+func fenced(code string) string {
+	return "```\n" + strings.TrimSuffix(code, "\n") + "\n```\n"
+}
+
+// loadTestTarget parses FILE[:FUNC] and extracts the code to test
+func loadTestTarget(arg string) (*testTarget, error) {
+	target := &testTarget{File: arg}
+	if _, err := os.Stat(arg); err != nil {
+		if i := strings.LastIndex(arg, ":"); i > 0 {
+			target.File, target.Func = arg[:i], arg[i+1:]
+		}
+	}
+
+	data, err := os.ReadFile(target.File)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", target.File, err)
+	}
+	source := string(data)
+
+	dir, base := filepath.Dir(target.File), filepath.Base(target.File)
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+
+	switch ext {
+	case ".go":
+		target.Language = "Go"
+		target.TestFile = filepath.Join(dir, stem+"_test.go")
+		return target, extractGoTarget(target, source)
+	case ".py":
+		target.Language = "Python"
+		target.TestFile = filepath.Join(dir, "test_"+stem+".py")
+		target.Source = source
+		if target.Func != "" {
+			target.Source, err = extractIndentedBlock(source, target.Func)
+		}
+	case ".js", ".mjs", ".cjs", ".ts":
+		lang, _ := languageForFile(base)
+		target.Language = lang.Name
+		target.TestFile = filepath.Join(dir, stem+".test"+ext)
+		target.Source = source
+		if target.Func != "" {
+			target.Source, err = extractBracedBlock(source, target.Func)
+		}
+	default:
+		return nil, fmt.Errorf("gen-test does not support %s files", ext)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if target.Func != "" {
+		target.Context = fmt.Sprintf("The function lives in %s; import it from there.\n", target.File)
+	}
+	return target, nil
+}
+
+// extractGoTarget fills in the package, the function source and the source of
+// the package-level types it refers to
+func extractGoTarget(target *testTarget, source string) error {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, target.File, source, parser.ParseComments)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", target.File, err)
+	}
+	target.Package = file.Name.Name
+
+	if target.Func == "" {
+		target.Source = source
+		return nil
+	}
+
+	recv, name, isMethod := strings.Cut(target.Func, ".")
+	if !isMethod {
+		name, recv = recv, ""
+	}
+
+	var fn *ast.FuncDecl
+	for _, decl := range file.Decls {
+		d, ok := decl.(*ast.FuncDecl)
+		if !ok || d.Name.Name != name {
+			continue
+		}
+		if recv == "" || (d.Recv != nil && receiverName(d) == recv) {
+			fn = d
+			break
+		}
+	}
+	if fn == nil {
+		return fmt.Errorf("function %s not found in %s", target.Func, target.File)
+	}
+
+	start := fn.Pos()
+	if fn.Doc != nil {
+		start = fn.Doc.Pos()
+	}
+	target.Source = source[fset.Position(start).Offset:fset.Position(fn.End()).Offset]
+
+	// Collect the identifiers used by the function and look up matching type
+	// declarations anywhere in the package
+	used := make(map[string]bool)
+	ast.Inspect(fn, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			used[id.Name] = true
+		}
+		return true
+	})
+
+	types := packageTypeDecls(filepath.Dir(target.File), target.Package)
+	var names []string
+	for name := range used {
+		if _, ok := types[name]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var context strings.Builder
+	for _, name := range names {
+		context.WriteString(types[name])
+		context.WriteString("\n\n")
+	}
+	if context.Len() > 0 {
+		target.Context = "Types used by the function (from package " + target.Package + "):\n\n" + fenced(context.String())
+	}
+	return nil
+}
+
+// receiverName returns the type name of a method receiver without the pointer
+func receiverName(fn *ast.FuncDecl) string {
+	expr := fn.Recv.List[0].Type
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if idx, ok := expr.(*ast.IndexExpr); ok {
+		expr = idx.X
+	}
+	if id, ok := expr.(*ast.Ident); ok {
+		return id.Name
+	}
+	return ""
+}
+
+// packageTypeDecls returns the source of every type declared in the non-test
+// files of a package directory, keyed by type name
+func packageTypeDecls(dir, pkg string) map[string]string {
+	types := make(map[string]string)
+
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	for _, path := range matches {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, path, data, parser.ParseComments)
+		if err != nil || file.Name.Name != pkg {
+			continue
+		}
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				ts := spec.(*ast.TypeSpec)
+				start, end := ts.Pos(), ts.End()
+				if len(gen.Specs) == 1 {
+					start = gen.Pos()
+					if gen.Doc != nil {
+						start = gen.Doc.Pos()
+					}
+				}
+				types[ts.Name.Name] = string(data[fset.Position(start).Offset:fset.Position(end).Offset])
+			}
+		}
+	}
+	return types
+}
+
+// extractIndentedBlock finds a Python def or class and returns it with its
+// indented body
+func extractIndentedBlock(source, name string) (string, error) {
+	re := regexp.MustCompile(`^(\s*)(?:async\s+)?(?:def|class)\s+` + regexp.QuoteMeta(name) + `\b`)
+	lines := strings.Split(source, "\n")
+	for i, line := range lines {
+		m := re.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		indent := len(m[1])
+
+		// Include decorators directly above the definition
+		start := i
+		for start > 0 && strings.HasPrefix(strings.TrimSpace(lines[start-1]), "@") {
+			start--
+		}
+
+		end := i + 1
+		for end < len(lines) {
+			l := lines[end]
+			if strings.TrimSpace(l) != "" && len(l)-len(strings.TrimLeft(l, " \t")) <= indent {
+				break
+			}
+			end++
+		}
+		return strings.TrimRight(strings.Join(lines[start:end], "\n"), "\n") + "\n", nil
+	}
+	return "", fmt.Errorf("function %s not found", name)
+}
+
+// extractBracedBlock finds a JavaScript function, arrow function or method
+// and returns it up to its matching closing brace
+func extractBracedBlock(source, name string) (string, error) {
+	q := regexp.QuoteMeta(name)
+	re := regexp.MustCompile(`(?m)^[ \t]*(?:export\s+)?(?:default\s+)?(?:async\s+)?(?:function\s*\*?\s*` + q + `\s*\(|(?:const|let|var)\s+` + q + `\s*=|` + q + `\s*\([^)]*\)\s*\{)`)
+	loc := re.FindStringIndex(source)
+	if loc == nil {
+		return "", fmt.Errorf("function %s not found", name)
+	}
+
+	open := strings.IndexByte(source[loc[0]:], '{')
+	if open < 0 {
+		// Expression-bodied arrow function: take the statement
+		end := strings.IndexAny(source[loc[0]:], ";\n")
+		if end < 0 {
+			end = len(source) - loc[0]
+		}
+		return source[loc[0] : loc[0]+end+1], nil
+	}
+
+	depth := 0
+	for i := loc[0] + open; i < len(source); i++ {
+		switch source[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return source[loc[0]:i+1] + "\n", nil
+			}
+		}
+	}
+	return source[loc[0]:], nil
+}
+
+// testStyleExample returns the start of an existing test file next to the
+// target so the model can copy its conventions
+func testStyleExample(target *testTarget) string {
+	dir := filepath.Dir(target.File)
+	var patterns []string
+	switch target.Language {
+	case "Go":
+		patterns = []string{"*_test.go"}
+	case "Python":
+		patterns = []string{"test_*.py", "*_test.py", filepath.Join("tests", "test_*.py")}
+	default:
+		patterns = []string{"*.test.*", "*.spec.*"}
+	}
+
+	for _, pattern := range patterns {
+		matches, _ := filepath.Glob(filepath.Join(dir, pattern))
+		for _, path := range matches {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			lines := strings.Split(string(data), "\n")
+			if len(lines) > 80 {
+				lines = lines[:80]
+			}
+			return fmt.Sprintf("Existing tests in this project (%s), follow their style:\n\n%s", path, fenced(strings.Join(lines, "\n")))
+		}
+	}
+	return ""
+}
+
+var goTestNameRe = regexp.MustCompile(`(?m)^func\s+((?:Test|Benchmark|Example|Fuzz)\w*)\s*\(`)
+
+// goTestNames lists the test functions declared in Go source
+func goTestNames(source string) []string {
+	var names []string
+	for _, m := range goTestNameRe.FindAllStringSubmatch(source, -1) {
+		names = append(names, m[1])
+	}
+	return names
+}
+
+// mergeTestFile combines generated tests with an existing test file
+func mergeTestFile(target *testTarget, existing, generated string) (string, error) {
+	if target.Language == "Go" {
+		return mergeGoTestFile(existing, generated)
+	}
+	if existing == "" {
+		return strings.TrimRight(generated, "\n") + "\n", nil
+	}
+
+	// Drop import lines the file already has and append the rest
+	have := make(map[string]bool)
+	for _, line := range strings.Split(existing, "\n") {
+		have[strings.TrimSpace(line)] = true
+	}
+	var kept []string
+	for _, line := range strings.Split(generated, "\n") {
+		trimmed := strings.TrimSpace(line)
+		isImport := strings.HasPrefix(trimmed, "import ") || strings.HasPrefix(trimmed, "from ") || strings.Contains(trimmed, "require(")
+		if isImport && have[trimmed] {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return strings.TrimRight(existing, "\n") + "\n\n" + strings.TrimRight(strings.Join(kept, "\n"), "\n") + "\n", nil
+}
+
+// mergeGoTestFile appends the declarations of a generated Go test file to an
+// existing one, adding any imports it is missing
+func mergeGoTestFile(existing, generated string) (string, error) {
+	fset := token.NewFileSet()
+	gen, err := parser.ParseFile(fset, "generated_test.go", generated, parser.ParseComments)
+	if err != nil {
+		return "", fmt.Errorf("generated tests do not parse: %v", err)
+	}
+	if existing == "" {
+		out, err := format.Source([]byte(generated))
+		return string(out), err
+	}
+
+	oldFset := token.NewFileSet()
+	old, err := parser.ParseFile(oldFset, "existing_test.go", existing, parser.ImportsOnly)
+	if err != nil {
+		return "", fmt.Errorf("existing test file does not parse: %v", err)
+	}
+	have := make(map[string]bool)
+	for _, imp := range old.Imports {
+		have[importKey(imp)] = true
+	}
+
+	// New imports go right after the existing file's imports (or package clause)
+	insertAt := old.Name.End()
+	for _, decl := range old.Decls {
+		if d, ok := decl.(*ast.GenDecl); ok && d.Tok == token.IMPORT {
+			insertAt = d.End()
+		}
+	}
+	offset := oldFset.Position(insertAt).Offset
+
+	var imports strings.Builder
+	for _, imp := range gen.Imports {
+		if key := importKey(imp); !have[key] {
+			imports.WriteString("\t" + key + "\n")
+		}
+	}
+
+	// Everything after the generated file's imports is the code to append
+	bodyStart := gen.Name.End()
+	for _, decl := range gen.Decls {
+		if d, ok := decl.(*ast.GenDecl); ok && d.Tok == token.IMPORT {
+			bodyStart = d.End()
+		}
+	}
+	body := generated[fset.Position(bodyStart).Offset:]
+
+	var merged strings.Builder
+	merged.WriteString(existing[:offset])
+	if imports.Len() > 0 {
+		merged.WriteString("\n\nimport (\n" + imports.String() + ")")
+	}
+	merged.WriteString(strings.TrimRight(existing[offset:], "\n"))
+	merged.WriteString("\n" + body)
+
+	formatted, err := format.Source([]byte(merged.String()))
+	if err != nil {
+		return "", fmt.Errorf("merged test file does not parse: %v", err)
+	}
+	return string(formatted), nil
+}
+
+// importKey renders an import spec as it appears in an import block
+func importKey(imp *ast.ImportSpec) string {
+	if imp.Name != nil {
+		return imp.Name.Name + " " + imp.Path.Value
+	}
+	return imp.Path.Value
+}
+
+// runTargetTests runs the tests just written and returns their output and
+// whether they passed
+func runTargetTests(target *testTarget, generated string) (string, bool) {
+	dir := filepath.Dir(target.File)
+	base := filepath.Base(target.TestFile)
+
+	var cmd *exec.Cmd
+	switch target.Language {
+	case "Go":
+		args := []string{"test", "."}
+		if names := goTestNames(generated); len(names) > 0 {
+			args = append(args, "-run", "^("+strings.Join(names, "|")+")$")
+		}
+		cmd = exec.Command("go", args...)
+	case "Python":
+		python, err := lookTool("python3")
+		if err != nil {
+			return "python is not installed", false
+		}
+		if exec.Command(python, "-m", "pytest", "--version").Run() == nil {
+			cmd = exec.Command(python, "-m", "pytest", "-q", base)
+		} else {
+			cmd = exec.Command(python, "-m", "unittest", strings.TrimSuffix(base, ".py"))
+		}
+	default:
+		pkg, _ := os.ReadFile(findUp(dir, "package.json"))
+		switch {
+		case bytes.Contains(pkg, []byte(`"vitest"`)):
+			cmd = exec.Command("npx", "vitest", "run", base)
+		case bytes.Contains(pkg, []byte(`"jest"`)):
+			cmd = exec.Command("npx", "jest", base)
+		default:
+			cmd = exec.Command("node", "--test", base)
+		}
+	}
+	cmd.Dir = dir
+
+	spinner, _ := pterm.DefaultSpinner.Start("Running " + strings.Join(cmd.Args, " "))
+	out, err := cmd.CombinedOutput()
+	spinner.Stop()
+	return strings.TrimSpace(string(out)), err == nil
+}
+
+// findUp returns the path of name in dir or its closest parent, or "" if none has it
+func findUp(dir, name string) string {
+	for {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lithammer/fuzzysearch/fuzzy"
+	"github.com/peterh/liner"
+	"github.com/pterm/pterm"
+	"github.com/spf13/viper"
+)
+
+// defaultHistorySize is how many prompts are kept when history.size is unset
+const defaultHistorySize = 1000
+
+// historyEntry is one line entered in the shell
+type historyEntry struct {
+	Text string    `json:"text"`
+	Dir  string    `json:"dir,omitempty"`
+	Time time.Time `json:"time"`
+}
+
+// historyStore is the shell history. Entries are deduplicated, keeping the
+// most recent use, and the oldest are dropped beyond the configured size.
+type historyStore struct {
+	path    string
+	entries []historyEntry
+	// added holds the entries recorded since the file was last saved,
+	// which save merges into what other shells wrote meanwhile
+	added []historyEntry
+}
+
+// promptHistory is the history of the running shell
+var promptHistory = &historyStore{}
+
+// historyPath returns the file the history is kept in
+func historyPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "history.jsonl"), nil
+}
+
+// loadHistory reads the history file. The plain-text history of earlier
+// versions is imported the first time.
+func loadHistory() (*historyStore, error) {
+	path, err := historyPath()
+	if err != nil {
+		return nil, err
+	}
+	h := &historyStore{path: path}
+
+	entries, err := readHistory(path)
+	if errors.Is(err, os.ErrNotExist) {
+		h.importLegacy()
+		return h, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %v", err)
+	}
+	for _, e := range entries {
+		h.record(e)
+	}
+	return h, nil
+}
+
+// readHistory reads the entries of a history file, oldest first
+func readHistory(path string) ([]historyEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []historyEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e historyEntry
+		if json.Unmarshal(scanner.Bytes(), &e) == nil && e.Text != "" {
+			entries = append(entries, e)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// importLegacy imports ~/.neurocli_history, which had one entry per line
+func (h *historyStore) importLegacy() {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return
+	}
+	data, err := os.ReadFile(filepath.Join(home, ".neurocli_history"))
+	if err != nil {
+		return
+	}
+	for _, text := range strings.Split(string(data), "\n") {
+		h.add(text, "")
+	}
+}
+
+// historySize returns the configured maximum number of entries
+func historySize() int {
+	if n := viper.GetInt("history.size"); n > 0 {
+		return n
+	}
+	return defaultHistorySize
+}
+
+// add records a line entered in dir. Lines starting with a space and lines
+// containing secrets are not recorded; add reports whether it was.
+func (h *historyStore) add(raw, dir string) bool {
+	if strings.HasPrefix(raw, " ") {
+		return false
+	}
+	text := strings.ReplaceAll(strings.TrimSpace(raw), "\n", " ")
+	if text == "" || containsSecret(text) {
+		return false
+	}
+
+	e := historyEntry{Text: text, Dir: dir, Time: time.Now()}
+	h.record(e)
+	h.added = append(h.added, e)
+	return true
+}
+
+// record appends an entry, dropping an earlier one with the same text and
+// the oldest beyond the configured size
+func (h *historyStore) record(e historyEntry) {
+	for i, old := range h.entries {
+		if old.Text == e.Text {
+			h.entries = append(h.entries[:i], h.entries[i+1:]...)
+			break
+		}
+	}
+	h.entries = append(h.entries, e)
+	if over := len(h.entries) - historySize(); over > 0 {
+		h.entries = h.entries[over:]
+	}
+}
+
+// containsSecret reports whether text holds a known credential or
+// something the redaction detectors flag
+func containsSecret(text string) bool {
+	if redactSecrets(text) != text {
+		return true
+	}
+	_, report, err := redactText(text)
+	return err == nil && report.Total() > 0
+}
+
+// save writes the history file, replacing it atomically. The file is read
+// again under a lock first, so entries saved by other shells since it was
+// loaded are kept.
+func (h *historyStore) save() error {
+	if h.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0700); err != nil {
+		return err
+	}
+
+	lock, err := os.OpenFile(h.path+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	if err := lockFile(lock); err != nil {
+		return err
+	}
+	defer unlockFile(lock)
+
+	saved, err := readHistory(h.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read history: %v", err)
+	}
+	merged := &historyStore{path: h.path}
+	for _, e := range saved {
+		merged.record(e)
+	}
+	for _, e := range h.added {
+		merged.record(e)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(h.path), ".history-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, e := range merged.entries {
+		if err := enc.Encode(e); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), h.path); err != nil {
+		return err
+	}
+	h.entries, h.added = merged.entries, nil
+	return nil
+}
+
+// texts returns the entries, oldest first. With dir set only entries
+// recorded in that directory are returned.
+func (h *historyStore) texts(dir string) []string {
+	var texts []string
+	for _, e := range h.entries {
+		if dir == "" || e.Dir == dir {
+			texts = append(texts, e.Text)
+		}
+	}
+	return texts
+}
+
+// historyFilterDir returns the directory prompts are recalled from, or ""
+// for all of them unless history.per_directory is set
+func historyFilterDir() string {
+	if viper.GetBool("history.per_directory") {
+		return currentDir()
+	}
+	return ""
+}
+
+// fill loads the history into liner for the arrow keys and Ctrl-R. With
+// history.per_directory set, only entries from the current directory are used.
+func (h *historyStore) fill(line *liner.State) {
+	line.ClearHistory()
+	for _, text := range h.texts(historyFilterDir()) {
+		line.AppendHistory(text)
+	}
+}
+
+// handleHistory lists the history, optionally filtered, or picks an entry
+// with fuzzy search to edit and run again
+func handleHistory(args []string) error {
+	var (
+		here, search bool
+		limit        = 25
+		terms        []string
+	)
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-d", "--here":
+			here = true
+		case "-s", "--search":
+			search = true
+		case "-n":
+			if i+1 >= len(args) {
+				return fmt.Errorf("usage: history [-d] [-n N] [-s] [PATTERN]")
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid count %q", args[i+1])
+			}
+			limit = n
+			i++
+		default:
+			terms = append(terms, args[i])
+		}
+	}
+
+	dir := ""
+	if here {
+		dir = currentDir()
+	}
+	texts := promptHistory.texts(dir)
+	query := strings.Join(terms, " ")
+
+	if search {
+		return searchHistory(texts, query)
+	}
+
+	// Entries keep their position in the history when filtered
+	numbers := make([]int, 0, len(texts))
+	for i := range texts {
+		numbers = append(numbers, i+1)
+	}
+	if query != "" {
+		re, err := regexp.Compile("(?i)" + query)
+		if err != nil {
+			return fmt.Errorf("invalid pattern: %v", err)
+		}
+		numbers = numbers[:0]
+		for i, t := range texts {
+			if re.MatchString(t) {
+				numbers = append(numbers, i+1)
+			}
+		}
+	}
+
+	for _, n := range numbers[max(len(numbers)-limit, 0):] {
+		fmt.Printf("%5d  %s\n", n, texts[n-1])
+	}
+	return nil
+}
+
+// searchHistory lets the user pick an entry with fuzzy filtering. The
+// chosen entry is put on the next prompt line for editing.
+func searchHistory(texts []string, query string) error {
+	choice, err := pickHistory(texts, query)
+	if err != nil || choice == "" {
+		return err
+	}
+	pendingSuggestion = choice
+	return nil
+}
+
+// pickHistory lets the user pick an entry, newest first and ranked by a
+// fuzzy match with query if one is given. It returns "" when there is
+// nothing to pick.
+func pickHistory(texts []string, query string) (string, error) {
+	if len(texts) == 0 {
+		pterm.Info.Println("History is empty")
+		return "", nil
+	}
+
+	options := make([]string, 0, len(texts))
+	for i := len(texts) - 1; i >= 0; i-- {
+		options = append(options, texts[i])
+	}
+	if query != "" {
+		ranks := fuzzy.RankFindFold(query, options)
+		if len(ranks) == 0 {
+			pterm.Info.Printf("No history entries match %q\n", query)
+			return "", nil
+		}
+		sort.Stable(ranks)
+		options = options[:0]
+		for _, r := range ranks {
+			options = append(options, r.Target)
+		}
+	}
+
+	return pterm.DefaultInteractiveSelect.
+		WithOptions(options).
+		WithFilter(true).
+		WithMaxHeight(10).
+		Show("History")
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// bashIntegration is printed by neurocli init bash
+const bashIntegration = `# neurocli shell integration for bash
+# Add to ~/.bashrc:  eval "$(neurocli init bash)"
+
+# Ctrl-G replaces the command line with a suggested command
+__neurocli_suggest() {
+  local suggestion
+  if ! suggestion=$(neurocli suggest -- "$READLINE_LINE"); then
+    printf '%s\n' "$suggestion" >&2
+    return
+  fi
+  READLINE_LINE=$suggestion
+  READLINE_POINT=${#READLINE_LINE}
+}
+bind -x '"\C-g": __neurocli_suggest'
+
+# With NEUROCLI_SUGGEST_NOT_FOUND=1, lines that look like a request rather
+# than a mistyped command are sent for a suggestion
+command_not_found_handle() {
+  printf 'bash: %s: command not found\n' "$1" >&2
+  if [ -n "${NEUROCLI_SUGGEST_NOT_FOUND:-}" ] && [ -t 2 ] && [ "$#" -gt 1 ]; then
+    local suggestion
+    suggestion=$(command neurocli suggest --skip-secrets -- "$*" 2>/dev/null) && [ -n "$suggestion" ] &&
+      printf 'neurocli suggests: %s\n' "$suggestion" >&2
+  fi
+  return 127
+}
+
+# Remember the last failed command, in this shell only, for neurocli fix
+__neurocli_last_histcmd=
+__neurocli_last_command=
+__neurocli_last_status=
+__neurocli_after_command() {
+  local exit_status=$? histcmd
+  histcmd=$(HISTTIMEFORMAT= history 1)
+  if [ "$histcmd" != "$__neurocli_last_histcmd" ]; then
+    __neurocli_last_histcmd=$histcmd
+    case $exit_status in
+      0|127|130) ;;
+      *)
+        __neurocli_last_command=$(printf '%s' "$histcmd" | sed 's/^ *[0-9]* *//')
+        __neurocli_last_status=$exit_status
+        printf '\033[2m(exit %d, run neurocli fix for a corrected command)\033[0m\n' "$exit_status" >&2
+        ;;
+    esac
+  fi
+  return $exit_status
+}
+PROMPT_COMMAND="__neurocli_after_command${PROMPT_COMMAND:+; $PROMPT_COMMAND}"
+
+# A plain neurocli fix gets the last failed command
+neurocli() {
+  if [ "$1" = fix ] && [ -n "$__neurocli_last_command" ]; then
+    local arg
+    for arg in "${@:2}"; do
+      case $arg in
+        -*) ;;
+        *) command neurocli "$@"; return ;;
+      esac
+    done
+    command neurocli "$@" --exit-status "$__neurocli_last_status" -- "$__neurocli_last_command"
+    return
+  fi
+  command neurocli "$@"
+}
+`
+
+// zshIntegration is printed by neurocli init zsh
+const zshIntegration = `# neurocli shell integration for zsh
+# Add to ~/.zshrc:  eval "$(neurocli init zsh)"
+
+# Ctrl-G replaces the command line with a suggested command
+__neurocli_suggest() {
+  local suggestion
+  zle -I
+  if ! suggestion=$(neurocli suggest -- "$BUFFER"); then
+    print -u2 -r -- "$suggestion"
+    return
+  fi
+  BUFFER=$suggestion
+  CURSOR=${#BUFFER}
+}
+zle -N __neurocli_suggest
+bindkey '^G' __neurocli_suggest
+
+# With NEUROCLI_SUGGEST_NOT_FOUND=1, lines that look like a request rather
+# than a mistyped command are sent for a suggestion
+command_not_found_handler() {
+  print -u2 -r -- "zsh: command not found: $1"
+  if [[ -n ${NEUROCLI_SUGGEST_NOT_FOUND:-} && -t 2 && $# -gt 1 ]]; then
+    local suggestion
+    suggestion=$(command neurocli suggest --skip-secrets -- "$*" 2>/dev/null) && [[ -n $suggestion ]] &&
+      print -u2 -r -- "neurocli suggests: $suggestion"
+  fi
+  return 127
+}
+
+# Remember the last failed command, in this shell only, for neurocli fix
+typeset -g __neurocli_command= __neurocli_last_command= __neurocli_last_status=
+__neurocli_preexec() {
+  __neurocli_command=$1
+}
+__neurocli_precmd() {
+  local exit_status=$?
+  if [[ -n $__neurocli_command ]]; then
+    case $exit_status in
+      0|127|130) ;;
+      *)
+        __neurocli_last_command=$__neurocli_command
+        __neurocli_last_status=$exit_status
+        print -u2 -P "%F{8}(exit $exit_status, run neurocli fix for a corrected command)%f"
+        ;;
+    esac
+  fi
+  __neurocli_command=
+}
+autoload -Uz add-zsh-hook
+add-zsh-hook preexec __neurocli_preexec
+add-zsh-hook precmd __neurocli_precmd
+
+# A plain neurocli fix gets the last failed command
+neurocli() {
+  if [[ $1 == fix && -n $__neurocli_last_command ]]; then
+    local arg
+    for arg in "${@:2}"; do
+      [[ $arg == -* ]] || { command neurocli "$@"; return }
+    done
+    command neurocli "$@" --exit-status "$__neurocli_last_status" -- "$__neurocli_last_command"
+    return
+  fi
+  command neurocli "$@"
+}
+`
+
+// fishIntegration is printed by neurocli init fish
+const fishIntegration = `# neurocli shell integration for fish
+# Add to ~/.config/fish/config.fish:  neurocli init fish | source
+
+# Ctrl-G replaces the command line with a suggested command
+function __neurocli_suggest
+    set -l suggestion (neurocli suggest -- (commandline | string collect))
+    if test $status -ne 0
+        printf '%s\n' $suggestion >&2
+        commandline -f repaint
+        return
+    end
+    commandline -r -- (string join \n -- $suggestion)
+    commandline -f repaint
+end
+bind \cg __neurocli_suggest
+bind -M insert \cg __neurocli_suggest 2>/dev/null
+
+# With NEUROCLI_SUGGEST_NOT_FOUND=1, lines that look like a request rather
+# than a mistyped command are sent for a suggestion
+function fish_command_not_found
+    printf 'fish: Unknown command: %s\n' $argv[1] >&2
+    if set -q NEUROCLI_SUGGEST_NOT_FOUND[1]; and test -n "$NEUROCLI_SUGGEST_NOT_FOUND"
+        and isatty stderr; and test (count $argv) -gt 1
+        set -l suggestion (command neurocli suggest --skip-secrets -- "$argv" 2>/dev/null)
+        and test -n "$suggestion"
+        and printf 'neurocli suggests: %s\n' "$suggestion" >&2
+    end
+end
+
+# Remember the last failed command, in this shell only, for neurocli fix
+function __neurocli_postexec --on-event fish_postexec
+    set -l exit_status $status
+    if not contains -- $exit_status 0 127 130
+        set -g __neurocli_last_command $argv[1]
+        set -g __neurocli_last_status $exit_status
+        printf '\e[2m(exit %d, run neurocli fix for a corrected command)\e[0m\n' $exit_status >&2
+    end
+end
+
+# A plain neurocli fix gets the last failed command
+function neurocli
+    if test "$argv[1]" = fix; and set -q __neurocli_last_command
+        for arg in $argv[2..-1]
+            if not string match -q -- '-*' $arg
+                command neurocli $argv
+                return
+            end
+        end
+        command neurocli $argv --exit-status $__neurocli_last_status -- $__neurocli_last_command
+        return
+    end
+    command neurocli $argv
+end
+`
+
+// shellIntegrations maps shell names to their integration script
+var shellIntegrations = map[string]string{
+	"bash": bashIntegration,
+	"zsh":  zshIntegration,
+	"fish": fishIntegration,
+}
+
+func newInitCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "init bash|zsh|fish",
+		Short: "Print the shell integration script",
+		Long: `Print a script that integrates neurocli with your shell:
+
+  - Ctrl-G replaces the command line with a suggested command, so you can
+    type what you want in plain words and edit the result before running it
+  - with NEUROCLI_SUGGEST_NOT_FOUND=1 set, a command-not-found handler
+    suggests a command for lines that read like a request; lines that look
+    like they contain a secret are never sent
+  - after a command fails, a hint offers 'neurocli fix', which then knows
+    the failed command and its exit status; they are kept in shell
+    variables, not exported to other programs
+
+Load it from your shell's startup file:
+
+  bash  ~/.bashrc                   eval "$(neurocli init bash)"
+  zsh   ~/.zshrc                    eval "$(neurocli init zsh)"
+  fish  ~/.config/fish/config.fish  neurocli init fish | source`,
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: []string{"bash", "zsh", "fish"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			script, ok := shellIntegrations[args[0]]
+			if !ok {
+				return fmt.Errorf("unsupported shell %q (supported: bash, zsh, fish)", args[0])
+			}
+			fmt.Print(script)
+			return nil
+		},
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// language describes how NeuroCLI handles code in one programming language.
+// Formatter commands read the code on stdin and write it to stdout; "{file}"
+// in their arguments is replaced by the output file name.
+type language struct {
+	Name         string
+	Aliases      []string
+	Extensions   []string
+	LineComment  string
+	BlockComment [2]string
+	Formatter    []string
+	Verifier     *codeVerifier
+}
+
+// languages is the registry of languages gen knows about. The first alias is
+// the one offered as a completion for --language.
+var languages = []language{
+	{
+		Name:         "Go",
+		Aliases:      []string{"go", "golang"},
+		Extensions:   []string{".go"},
+		LineComment:  "//",
+		BlockComment: [2]string{"/*", "*/"},
+		Formatter:    []string{"gofmt"},
+		Verifier: &codeVerifier{
+			File:  "main.go",
+			Setup: [][]string{{"go", "mod", "init", "neurocli.verify"}, {"go", "mod", "tidy"}},
+			Steps: [][]string{{"gofmt", "-e", "-l", "{file}"}, {"go", "vet", "./..."}, {"go", "build", "-o", os.DevNull, "./..."}},
+		},
+	},
+	{
+		Name:         "Python",
+		Aliases:      []string{"python", "py", "python3"},
+		Extensions:   []string{".py"},
+		LineComment:  "#",
+		BlockComment: [2]string{`"""`, `"""`},
+		Formatter:    []string{"black", "-q", "-"},
+		Verifier: &codeVerifier{
+			File:  "main.py",
+			Steps: [][]string{{"python3", "-m", "py_compile", "{file}"}},
+		},
+	},
+	{
+		Name:         "JavaScript",
+		Aliases:      []string{"javascript", "js", "jsx", "node", "nodejs"},
+		Extensions:   []string{".js", ".mjs", ".cjs", ".jsx"},
+		LineComment:  "//",
+		BlockComment: [2]string{"/*", "*/"},
+		Formatter:    []string{"prettier", "--stdin-filepath", "{file}"},
+		Verifier: &codeVerifier{
+			File:  "main.js",
+			Steps: [][]string{{"node", "--check", "{file}"}},
+		},
+	},
+	{
+		Name:         "TypeScript",
+		Aliases:      []string{"typescript", "ts", "tsx"},
+		Extensions:   []string{".ts", ".tsx"},
+		LineComment:  "//",
+		BlockComment: [2]string{"/*", "*/"},
+		Formatter:    []string{"prettier", "--stdin-filepath", "{file}"},
+	},
+	{
+		Name:         "Rust",
+		Aliases:      []string{"rust", "rs"},
+		Extensions:   []string{".rs"},
+		LineComment:  "//",
+		BlockComment: [2]string{"/*", "*/"},
+		Formatter:    []string{"rustfmt", "--emit", "stdout", "--edition", "2021"},
+	},
+	{
+		Name:         "Ruby",
+		Aliases:      []string{"ruby", "rb"},
+		Extensions:   []string{".rb"},
+		LineComment:  "#",
+		BlockComment: [2]string{"=begin", "=end"},
+	},
+	{
+		Name:         "Java",
+		Aliases:      []string{"java"},
+		Extensions:   []string{".java"},
+		LineComment:  "//",
+		BlockComment: [2]string{"/*", "*/"},
+		Formatter:    []string{"clang-format", "--assume-filename={file}"},
+	},
+	{
+		Name:         "C",
+		Aliases:      []string{"c"},
+		Extensions:   []string{".c", ".h"},
+		LineComment:  "//",
+		BlockComment: [2]string{"/*", "*/"},
+		Formatter:    []string{"clang-format", "--assume-filename={file}"},
+	},
+	{
+		Name:         "C++",
+		Aliases:      []string{"cpp", "c++", "cxx", "cc"},
+		Extensions:   []string{".cpp", ".cc", ".cxx", ".hpp", ".hh"},
+		LineComment:  "//",
+		BlockComment: [2]string{"/*", "*/"},
+		Formatter:    []string{"clang-format", "--assume-filename={file}"},
+	},
+	{
+		Name:         "C#",
+		Aliases:      []string{"csharp", "cs", "c#"},
+		Extensions:   []string{".cs"},
+		LineComment:  "//",
+		BlockComment: [2]string{"/*", "*/"},
+	},
+	{
+		Name:         "PHP",
+		Aliases:      []string{"php"},
+		Extensions:   []string{".php"},
+		LineComment:  "//",
+		BlockComment: [2]string{"/*", "*/"},
+	},
+	{
+		Name:         "Kotlin",
+		Aliases:      []string{"kotlin", "kt"},
+		Extensions:   []string{".kt", ".kts"},
+		LineComment:  "//",
+		BlockComment: [2]string{"/*", "*/"},
+	},
+	{
+		Name:         "Swift",
+		Aliases:      []string{"swift"},
+		Extensions:   []string{".swift"},
+		LineComment:  "//",
+		BlockComment: [2]string{"/*", "*/"},
+	},
+	{
+		Name:        "Shell",
+		Aliases:     []string{"bash", "sh", "shell", "zsh", "console"},
+		Extensions:  []string{".sh", ".bash", ".zsh"},
+		LineComment: "#",
+		Formatter:   []string{"shfmt", "-"},
+		Verifier: &codeVerifier{
+			File:  "main.sh",
+			Steps: [][]string{{"bash", "-n", "{file}"}},
+		},
+	},
+	{
+		Name:        "SQL",
+		Aliases:     []string{"sql"},
+		Extensions:  []string{".sql"},
+		LineComment: "--",
+	},
+	{
+		Name:        "YAML",
+		Aliases:     []string{"yaml", "yml"},
+		Extensions:  []string{".yaml", ".yml"},
+		LineComment: "#",
+		Formatter:   []string{"prettier", "--stdin-filepath", "{file}"},
+	},
+	{
+		Name:       "JSON",
+		Aliases:    []string{"json"},
+		Extensions: []string{".json"},
+		Formatter:  []string{"prettier", "--stdin-filepath", "{file}"},
+	},
+	{
+		Name:         "HTML",
+		Aliases:      []string{"html"},
+		Extensions:   []string{".html", ".htm"},
+		BlockComment: [2]string{"<!--", "-->"},
+		Formatter:    []string{"prettier", "--stdin-filepath", "{file}"},
+	},
+	{
+		Name:         "CSS",
+		Aliases:      []string{"css"},
+		Extensions:   []string{".css"},
+		BlockComment: [2]string{"/*", "*/"},
+		Formatter:    []string{"prettier", "--stdin-filepath", "{file}"},
+	},
+}
+
+// lookupLanguage finds a language by name or alias, ignoring case
+func lookupLanguage(name string) (*language, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for i := range languages {
+		lang := &languages[i]
+		if strings.ToLower(lang.Name) == name {
+			return lang, true
+		}
+		for _, alias := range lang.Aliases {
+			if alias == name {
+				return lang, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// languageForFile finds a language by the extension of path
+func languageForFile(path string) (*language, bool) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == "" {
+		return nil, false
+	}
+	for i := range languages {
+		for _, e := range languages[i].Extensions {
+			if e == ext {
+				return &languages[i], true
+			}
+		}
+	}
+	return nil, false
+}
+
+// languageCompletions returns the primary alias of every registered language
+func languageCompletions() []string {
+	names := make([]string, 0, len(languages))
+	for _, lang := range languages {
+		names = append(names, lang.Aliases[0])
+	}
+	return names
+}
+
+// resolveLanguage turns the --language value into a display name, inferring
+// it from the output file's extension when the flag wasn't given
+func resolveLanguage(name string, explicit bool, output string) (string, *language) {
+	if !explicit && output != "" {
+		if lang, ok := languageForFile(output); ok {
+			return lang.Name, lang
+		}
+	}
+	if name == "" {
+		name = "python"
+	}
+	if lang, ok := lookupLanguage(name); ok {
+		return lang.Name, lang
+	}
+	return strings.ToUpper(name[:1]) + name[1:], nil
+}
+
+// formatCode runs code through the language's formatter if it is installed.
+// It returns the code unchanged when there is no formatter available.
+func formatCode(lang *language, code, filename string) (string, error) {
+	if lang == nil || len(lang.Formatter) == 0 {
+		return code, nil
+	}
+	path, err := lookTool(lang.Formatter[0])
+	if err != nil {
+		return code, nil
+	}
+	if filename == "" {
+		filename = "main" + lang.Extensions[0]
+	}
+
+	args := make([]string, len(lang.Formatter)-1)
+	for i, arg := range lang.Formatter[1:] {
+		args[i] = strings.ReplaceAll(arg, "{file}", filename)
+	}
+
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = strings.NewReader(code)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return code, fmt.Errorf("%s failed: %v: %s", lang.Formatter[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/peterh/liner"
+	"github.com/pterm/pterm"
+)
+
+// continuationPrompt is shown while reading the rest of a multiline input
+const continuationPrompt = "... "
+
+// pendingInput is submitted as the next input instead of prompting, e.g.
+// after composing a prompt in the editor
+var pendingInput string
+
+// pendingSuggestion is put on the next prompt line for editing, e.g. an
+// entry picked from the history
+var pendingSuggestion string
+
+// readInput reads one input from the shell. A line starting with """ opens
+// a block that runs until the closing """, and a line ending with a
+// backslash continues on the next line. For ! commands the backslash is
+// kept so the system shell sees the usual line continuation. Multiline
+// pastes arrive as placeholders and are expanded here.
+func readInput(line *liner.State) (string, error) {
+	shellInput.clearPastes()
+	input, err := promptLine(line, getPrompt(), pendingSuggestion)
+	pendingSuggestion = ""
+	if err != nil {
+		return "", err
+	}
+	input, err = continueInput(input, func() (string, error) {
+		return promptLine(line, continuationPrompt, "")
+	})
+	if err != nil {
+		return "", err
+	}
+	return shellInput.expandPastes(input), nil
+}
+
+// promptLine reads one line, starting out with suggestion. Ctrl-X Ctrl-E
+// opens the line in the editor and returns what was written there instead;
+// Ctrl-R searches the history for it and prompts again with the entry
+// picked.
+func promptLine(line *liner.State, prompt, suggestion string) (string, error) {
+	for {
+		shellInput.arm()
+		var input string
+		var err error
+		if suggestion != "" {
+			input, err = line.PromptWithSuggestion(prompt, suggestion, -1)
+		} else {
+			input, err = line.Prompt(prompt)
+		}
+		end := shellInput.done()
+		if err != nil {
+			return input, err
+		}
+
+		switch end {
+		case endEdit:
+			edited, err := editText(shellInput.expandPastes(input))
+			if err != nil {
+				return "", err
+			}
+			fmt.Println(edited)
+			return edited, nil
+		case endSearch:
+			choice, err := pickHistory(promptHistory.texts(historyFilterDir()), input)
+			if err != nil {
+				return "", err
+			}
+			suggestion = input
+			if choice != "" {
+				suggestion = choice
+			}
+			continue
+		}
+		return input, nil
+	}
+}
+
+// continueInput completes an input starting with the line input, reading
+// further lines with next while a """ block is open or a line ends with a
+// backslash
+func continueInput(input string, next func() (string, error)) (string, error) {
+	var err error
+	if rest, ok := strings.CutPrefix(strings.TrimSpace(input), `"""`); ok {
+		var lines []string
+		for {
+			if i := strings.Index(rest, `"""`); i >= 0 {
+				lines = append(lines, rest[:i])
+				break
+			}
+			lines = append(lines, rest)
+			if rest, err = next(); err != nil {
+				return "", err
+			}
+		}
+		return strings.Trim(strings.Join(lines, "\n"), "\n"), nil
+	}
+
+	command := strings.HasPrefix(strings.TrimSpace(input), "!")
+	var lines []string
+	for strings.HasSuffix(input, `\`) {
+		if command {
+			lines = append(lines, input)
+		} else {
+			lines = append(lines, strings.TrimSuffix(input, `\`))
+		}
+		if input, err = next(); err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(append(lines, input), "\n"), nil
+}
+
+// handleEditPrompt opens $EDITOR on a temporary file and submits what was
+// written as the next prompt
+func handleEditPrompt(args []string) error {
+	prompt, err := editText("")
+	if err != nil {
+		return err
+	}
+	if prompt == "" {
+		pterm.Info.Println("Empty prompt, nothing sent")
+		return nil
+	}
+	fmt.Println(prompt)
+	pendingInput = prompt
+	return nil
+}
+
+// editText opens text in the editor and returns it as written, trimmed
+func editText(text string) (string, error) {
+	f, err := os.CreateTemp("", "neurocli-prompt-*.md")
+	if err != nil {
+		return "", err
+	}
+	path := f.Name()
+	defer os.Remove(path)
+	_, werr := f.WriteString(text)
+	if err := f.Close(); werr != nil || err != nil {
+		return "", errors.Join(werr, err)
+	}
+
+	if err := runEditor(path); err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// runEditor opens path in the user's editor and waits for it to exit
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+
+	// The editor setting may carry arguments, e.g. "code --wait"
+	fields := strings.Fields(editor)
+	cmd := exec.Command(fields[0], append(fields[1:], path)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor %s failed: %v", fields[0], err)
+	}
+	return nil
+}
@@ -9,11 +9,13 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"runtime"
 	"strings"
@@ -35,7 +37,7 @@ type Message struct {
 type ChatRequest struct {
 	Model       string    `json:"model"`
 	Messages    []Message `json:"messages"`
-	Temperature float64   `json:"temperature,omitempty"`
+	Temperature float64   `json:"temperature"`
 	MaxTokens   int       `json:"max_tokens,omitempty"`
 }
 
@@ -82,6 +84,20 @@ Examples:
 func init() {
 	cobra.OnInitialize(initConfig)
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.neurocli.yaml)")
+	rootCmd.PersistentFlags().String("provider", "pollinations", "AI provider to use ("+strings.Join(providerNames(), ", ")+")")
+	viper.BindPFlag("provider", rootCmd.PersistentFlags().Lookup("provider"))
+	rootCmd.PersistentFlags().String("model", "", "model to request (default is the provider's default model)")
+	viper.BindPFlag("model", rootCmd.PersistentFlags().Lookup("model"))
+	rootCmd.PersistentFlags().String("redact", "mask", "redaction of secrets and PII sent to the model (mask, strict, off)")
+	viper.BindPFlag("redaction.mode", rootCmd.PersistentFlags().Lookup("redact"))
+	rootCmd.PersistentFlags().String("persona", "default", "named persona to answer as (default, sre, go-reviewer, terse or one from the config)")
+	viper.BindPFlag("persona", rootCmd.PersistentFlags().Lookup("persona"))
+	rootCmd.PersistentFlags().String("system", "", "system prompt to use instead of the persona")
+	viper.BindPFlag("system", rootCmd.PersistentFlags().Lookup("system"))
+	viper.SetDefault("include_environment", true)
+	viper.SetDefault("temperature", 0.7)
+	viper.SetDefault("max_tokens", 2000)
+	registerGlobalCompletions(rootCmd)
 
 	// Add commands
 	rootCmd.AddCommand(newAskCmd())
@@ -89,6 +105,17 @@ func init() {
 	rootCmd.AddCommand(newShellCmd())
 	rootCmd.AddCommand(newAIDiffCmd())
 	rootCmd.AddCommand(newAICommitCmd())
+	rootCmd.AddCommand(newAuthCmd())
+	rootCmd.AddCommand(newEditCmd())
+	rootCmd.AddCommand(newUndoCmd())
+	rootCmd.AddCommand(newGenTestCmd())
+	rootCmd.AddCommand(newRunCmd())
+	rootCmd.AddCommand(newCmdCmd())
+	rootCmd.AddCommand(newExplainCmd())
+	rootCmd.AddCommand(newSuggestCmd())
+	rootCmd.AddCommand(newFixCmd())
+	rootCmd.AddCommand(newInitCmd())
+	rootCmd.AddCommand(newCompletionCmd())
 
 	// Set default command to handle natural language
 	rootCmd.RunE = func(cmd *cobra.Command, args []string) error {
@@ -117,7 +144,7 @@ func init() {
 		}
 
 		// Otherwise, just print the response
-		fmt.Println(response)
+		printMarkdown(response)
 		return nil
 	}
 }
@@ -140,15 +167,17 @@ func initConfig() {
 	viper.AutomaticEnv()
 
 	if err := viper.ReadInConfig(); err == nil {
-		pterm.Info.Println("Using config file:", viper.ConfigFileUsed())
+		// On stderr, so the output of suggest and cmd --json stays clean
+		pterm.Info.WithWriter(os.Stderr).Println("Using config file:", viper.ConfigFileUsed())
 	}
 }
 
 func newAskCmd() *cobra.Command {
 	return &cobra.Command{
-		Use:   "ask [prompt]",
-		Short: "Ask a question to the AI",
-		Args:  cobra.MinimumNArgs(1),
+		Use:               "ask [prompt]",
+		Short:             "Ask a question to the AI",
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: cobra.NoFileCompletions,
 		Run: func(cmd *cobra.Command, args []string) {
 			prompt := strings.Join(args, " ")
 			response, err := askAI(prompt)
@@ -157,7 +186,7 @@ func newAskCmd() *cobra.Command {
 				return
 			}
 			pterm.Info.Println("AI Response:")
-			fmt.Println(response)
+			printMarkdown(response)
 		},
 	}
 }
@@ -181,6 +210,10 @@ Return only the code without any explanations.`
 type genOptions struct {
 	output   string
 	language string
+	project  string
+	force    bool
+	verify   bool
+	attempts int
 }
 
 func newGenerateCmd() *cobra.Command {
@@ -195,22 +228,26 @@ Supports multiple programming languages with sensible defaults.`,
   neurocli gen -o script.py "function that reverses a string"
   
   # Generate Go code
-  neurocli gen -l go -o main.go "simple HTTP server"`,
+  neurocli gen -l go -o main.go "simple HTTP server"
+
+  # Generate a multi-file project
+  neurocli gen -l go --project ./todo-api "REST API for a todo list with tests"`,
 		Args: cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			description := strings.Join(args, " ")
 
-			// Validate language
-			opts.language = strings.ToLower(opts.language)
-			switch opts.language {
-			case "", "python", "py":
-				opts.language = "Python"
-			case "go", "golang":
-				opts.language = "Go"
-			case "js", "javascript":
-				opts.language = "JavaScript"
-			default:
-				opts.language = strings.Title(opts.language)
+			// Resolve the language, inferring it from the output file if needed
+			var lang *language
+			opts.language, lang = resolveLanguage(opts.language, cmd.Flags().Changed("language"), opts.output)
+
+			if opts.project != "" {
+				if opts.output != "" {
+					return fmt.Errorf("--output and --project cannot be used together")
+				}
+				if opts.verify {
+					return fmt.Errorf("--verify is not supported with --project")
+				}
+				return generateProject(description, opts.language, opts.project, opts.force)
 			}
 
 			pterm.Info.Printf("Generating %s code...\n", pterm.Cyan(opts.language))
@@ -224,12 +261,34 @@ Supports multiple programming languages with sensible defaults.`,
 				return fmt.Errorf("failed to generate code: %w", err)
 			}
 
-			// Clean up the response
-			code = cleanCodeResponse(code)
+			// Pull the code out of the response
+			code = extractCode(code, opts.language)
+
+			// Check that the code builds, feeding errors back to the model
+			verified := true
+			if opts.verify {
+				code, verified, err = verifyAndRepair(opts.language, description, code, opts.attempts)
+				if errors.Is(err, errNoVerifier) {
+					pterm.Warning.Printf("Skipping verification: %v\n", err)
+					verified = true
+				} else if err != nil {
+					return err
+				}
+			}
+
+			// Run the code through the language's formatter
+			if formatted, err := formatCode(lang, code, opts.output); err != nil {
+				pterm.Warning.WithWriter(os.Stderr).Printf("Skipping formatting: %v\n", err)
+			} else {
+				code = formatted
+			}
 
 			// Handle output
 			if opts.output == "" {
 				fmt.Println(code)
+				if !verified {
+					return fmt.Errorf("generated code still fails verification after %d attempts", opts.attempts)
+				}
 				return nil
 			}
 
@@ -243,6 +302,10 @@ Supports multiple programming languages with sensible defaults.`,
 				return fmt.Errorf("failed to write file: %w", err)
 			}
 
+			if !verified {
+				return fmt.Errorf("generated code in %s still fails verification after %d attempts", opts.output, opts.attempts)
+			}
+
 			pterm.Success.Printf("✓ Successfully generated %s code in %s\n",
 				pterm.Cyan(opts.language),
 				pterm.Green(opts.output))
@@ -252,36 +315,67 @@ Supports multiple programming languages with sensible defaults.`,
 
 	// Flags
 	cmd.Flags().StringVarP(&opts.output, "output", "o", "", "Output file (default: print to console)")
-	cmd.Flags().StringVarP(&opts.language, "language", "l", "python", "Programming language (python, go, js, etc.)")
+	cmd.Flags().StringVarP(&opts.language, "language", "l", "python", "Programming language (python, go, js, etc.; inferred from --output when not set)")
+	cmd.Flags().StringVar(&opts.project, "project", "", "Generate a multi-file project into this directory")
+	cmd.Flags().BoolVar(&opts.force, "force", false, "Overwrite existing files when generating a project")
+	cmd.Flags().BoolVar(&opts.verify, "verify", false, "Check that the code builds and let the AI fix reported errors")
+	cmd.Flags().IntVar(&opts.attempts, "max-attempts", 3, "Maximum number of build checks with --verify")
 
 	// Register completions
 	cmd.RegisterFlagCompletionFunc("language", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
-		return []string{"python", "go", "javascript", "typescript", "rust", "ruby"}, cobra.ShellCompDirectiveNoFileComp
+		return languageCompletions(), cobra.ShellCompDirectiveNoFileComp
 	})
+	cmd.RegisterFlagCompletionFunc("project", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return nil, cobra.ShellCompDirectiveFilterDirs
+	})
+	cmd.RegisterFlagCompletionFunc("max-attempts", cobra.NoFileCompletions)
 
 	return cmd
 }
 
-// cleanCodeResponse removes markdown code blocks and trims whitespace
-func cleanCodeResponse(code string) string {
-	code = strings.TrimSpace(code)
+// defaultSystemPrompt is the system message sent with every request unless overridden
+const defaultSystemPrompt = "You are NeuroCLI, an AI assistant specialized in command-line tools and code generation. Provide clear, concise, and technically accurate responses. Format code blocks with proper syntax highlighting and include only necessary explanations."
 
-	// Remove markdown code blocks if present
-	if strings.HasPrefix(code, "```") {
-		lines := strings.Split(code, "\n")
-		if len(lines) > 2 {
-			code = strings.Join(lines[1:len(lines)-1], "\n")
-		}
+// askAI sends a prompt using the active persona or --system override
+func askAI(prompt string) (string, error) {
+	system, err := activeSystemPrompt()
+	if err != nil {
+		return "", err
 	}
+	return askAIWithSystem(system, prompt)
+}
 
-	return code
+// askAIWithSystem sends a prompt with a custom system message to the active
+// provider, scrubbing credentials from any error
+func askAIWithSystem(system, prompt string) (string, error) {
+	response, err := sendChat(system, prompt)
+	return response, redactError(err)
 }
 
-func askAI(prompt string) (string, error) {
+func sendChat(system, prompt string) (string, error) {
+	provider, err := activeProvider()
+	if err != nil {
+		return "", err
+	}
+
+	apiKey, _, err := resolveAPIKey(provider)
+	if err != nil {
+		return "", err
+	}
+	if apiKey == "" && provider.KeyRequired {
+		return "", fmt.Errorf("no API key for %s; set %s or run 'neurocli auth login --provider %s'",
+			provider.Name, provider.KeyEnv, provider.Name)
+	}
+
+	prompt, err = redactOutgoing(prompt)
+	if err != nil {
+		return "", err
+	}
+
 	messages := []Message{
 		{
 			Role:    "system",
-			Content: "You are NeuroCLI, an AI assistant specialized in command-line tools and code generation. Provide clear, concise, and technically accurate responses. Format code blocks with proper syntax highlighting and include only necessary explanations.",
+			Content: system,
 		},
 		{
 			Role:    "user",
@@ -290,10 +384,10 @@ func askAI(prompt string) (string, error) {
 	}
 
 	reqData := ChatRequest{
-		Model:       "openai",
+		Model:       activeModel(provider),
 		Messages:    messages,
-		Temperature: 0.7,
-		MaxTokens:   2000,
+		Temperature: viper.GetFloat64("temperature"),
+		MaxTokens:   viper.GetInt("max_tokens"),
 	}
 
 	reqBody, err := json.Marshal(reqData)
@@ -301,7 +395,16 @@ func askAI(prompt string) (string, error) {
 		return "", fmt.Errorf("error marshaling request: %v", err)
 	}
 
-	resp, err := http.Post(apiURL, "application/json", bytes.NewBuffer(reqBody))
+	req, err := http.NewRequest(http.MethodPost, provider.URL, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("error making request: %v", err)
 	}
@@ -341,6 +444,28 @@ func askAI(prompt string) (string, error) {
 }
 
 func executeCommand(cmdStr string) error {
+	cmd := shellCommand(cmdStr)
+
+	// Connect to standard streams
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return runCommand(cmd)
+}
+
+// runCommand runs cmd, letting Ctrl-C stop the command without stopping NeuroCLI
+func runCommand(cmd *exec.Cmd) error {
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	return cmd.Run()
+}
+
+// shellCommand builds a command that runs cmdStr in the system shell with
+// the environment tracked by the interactive shell
+func shellCommand(cmdStr string) *exec.Cmd {
 	var cmd *exec.Cmd
 
 	// Use the appropriate shell based on the OS
@@ -349,28 +474,32 @@ func executeCommand(cmdStr string) error {
 	} else {
 		cmd = exec.Command("sh", "-c", cmdStr)
 	}
-
-	// Connect to standard streams
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	// Run the command
-	return cmd.Run()
+	cmd.Env = shellVars.environ()
+	return cmd
 }
 
 func newAIDiffCmd() *cobra.Command {
 	return &cobra.Command{
-		Use:   "ai-diff",
+		Use:   "ai-diff [RANGE] [-- PATH...]",
 		Short: "Explain git diff changes using AI",
+		Long: `Explain the staged changes, or the changes in a revision range such as
+main..HEAD or HEAD~3. Arguments are passed on to git diff.`,
+		ValidArgsFunction: completeGitRange,
 		Run: func(cmd *cobra.Command, args []string) {
-			explanation, err := AIDiff()
+			// Keep the -- that separates paths, which cobra drops
+			if n := cmd.ArgsLenAtDash(); n >= 0 {
+				args = append(append(args[:n:n], "--"), args[n:]...)
+				if n == 0 {
+					args = append([]string{"--cached"}, args...)
+				}
+			}
+			explanation, err := AIDiff(args...)
 			if err != nil {
 				pterm.Error.Println("Error:", err)
 				return
 			}
 			pterm.Info.Println("AI Explanation of Changes:")
-			fmt.Println(explanation)
+			printMarkdown(explanation)
 		},
 	}
 }
@@ -412,8 +541,10 @@ func newShellCmd() *cobra.Command {
 }
 
 func main() {
+	registerTemplateCommands(rootCmd)
+
 	if err := rootCmd.Execute(); err != nil {
-		pterm.Error.Println(err)
+		pterm.Error.Println(redactSecrets(err.Error()))
 		os.Exit(1)
 	}
 }
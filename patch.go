@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// filePatch is a set of edits for one file parsed from a model response
+type filePatch struct {
+	Path   string
+	Blocks []searchReplace
+	Hunks  []diffHunk
+}
+
+// searchReplace replaces one exact occurrence of Search with Replace
+type searchReplace struct {
+	Search  string
+	Replace string
+}
+
+// diffHunk is one hunk of a unified diff
+type diffHunk struct {
+	OldStart int
+	Lines    []string // prefixed with ' ', '-' or '+'
+}
+
+const (
+	searchMarker  = "<<<<<<< SEARCH"
+	dividerMarker = "======="
+	replaceMarker = ">>>>>>> REPLACE"
+)
+
+// parsePatches reads search/replace blocks or, failing that, a unified diff
+// from a model response
+func parsePatches(response string) ([]*filePatch, error) {
+	if strings.Contains(response, searchMarker) {
+		return parseSearchReplace(response)
+	}
+	if strings.Contains(response, "\n@@ ") || strings.HasPrefix(response, "@@ ") || strings.Contains(response, "+++ ") {
+		return parseUnifiedDiff(response)
+	}
+	return nil, fmt.Errorf("response contains neither search/replace blocks nor a unified diff")
+}
+
+// parseSearchReplace parses blocks of the form
+//
+//	path/to/file
+//	<<<<<<< SEARCH
+//	old lines
+//	=======
+//	new lines
+//	>>>>>>> REPLACE
+func parseSearchReplace(response string) ([]*filePatch, error) {
+	lines := strings.Split(strings.ReplaceAll(response, "\r\n", "\n"), "\n")
+
+	var patches []*filePatch
+	byPath := make(map[string]*filePatch)
+	lastPath := ""
+
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed != searchMarker {
+			if candidate := strings.Trim(trimmed, "`*#: "); candidate != "" && !strings.HasPrefix(trimmed, "```") {
+				lastPath = candidate
+			}
+			continue
+		}
+		if lastPath == "" {
+			return nil, fmt.Errorf("search/replace block on line %d has no file name", i+1)
+		}
+
+		// The divider is only looked for between the header and the
+		// trailer, so content lines that look like it are kept
+		end, dividers := i+1, []int(nil)
+		for ; end < len(lines); end++ {
+			trimmed := strings.TrimSpace(lines[end])
+			if trimmed == replaceMarker || trimmed == searchMarker {
+				break
+			}
+			if trimmed == dividerMarker {
+				dividers = append(dividers, end)
+			}
+		}
+		switch {
+		case len(dividers) == 0:
+			return nil, fmt.Errorf("unterminated search block for %s", lastPath)
+		case end == len(lines) || strings.TrimSpace(lines[end]) != replaceMarker:
+			return nil, fmt.Errorf("unterminated replace block for %s", lastPath)
+		case len(dividers)%2 == 0:
+			return nil, fmt.Errorf("search/replace block for %s has %d %s lines; the divider is ambiguous", lastPath, len(dividers), dividerMarker)
+		}
+		// An edit usually keeps such lines on both sides, so the divider is
+		// the middle one
+		divider := dividers[len(dividers)/2]
+		search, replace := lines[i+1:divider], lines[divider+1:end]
+
+		p, ok := byPath[lastPath]
+		if !ok {
+			p = &filePatch{Path: lastPath}
+			byPath[lastPath] = p
+			patches = append(patches, p)
+		}
+		p.Blocks = append(p.Blocks, searchReplace{
+			Search:  joinBlockLines(search),
+			Replace: joinBlockLines(replace),
+		})
+		i = end
+	}
+
+	if len(patches) == 0 {
+		return nil, fmt.Errorf("no search/replace blocks found")
+	}
+	return patches, nil
+}
+
+// joinBlockLines joins the lines of a search or replace block, each ending
+// with a newline
+func joinBlockLines(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+var hunkHeaderRe = regexp.MustCompile(`^@@ -(\d+)(?:,\d+)? \+\d+(?:,\d+)? @@`)
+
+// parseUnifiedDiff parses a unified diff, possibly wrapped in a code fence
+func parseUnifiedDiff(response string) ([]*filePatch, error) {
+	lines := strings.Split(strings.ReplaceAll(response, "\r\n", "\n"), "\n")
+
+	var patches []*filePatch
+	var current *filePatch
+	var hunk *diffHunk
+
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "+++ "):
+			path := strings.TrimSpace(strings.TrimPrefix(line, "+++ "))
+			if i := strings.IndexByte(path, '\t'); i >= 0 {
+				path = path[:i]
+			}
+			path = strings.TrimPrefix(path, "b/")
+			current = &filePatch{Path: path}
+			patches = append(patches, current)
+			hunk = nil
+		case strings.HasPrefix(line, "--- "), strings.HasPrefix(line, "diff "), strings.HasPrefix(line, "index "):
+			hunk = nil
+		case strings.HasPrefix(line, "@@"):
+			if current == nil {
+				return nil, fmt.Errorf("hunk without a file header")
+			}
+			m := hunkHeaderRe.FindStringSubmatch(line)
+			if m == nil {
+				return nil, fmt.Errorf("malformed hunk header %q", line)
+			}
+			start, _ := strconv.Atoi(m[1])
+			current.Hunks = append(current.Hunks, diffHunk{OldStart: start})
+			hunk = &current.Hunks[len(current.Hunks)-1]
+		case hunk != nil && line != "" && strings.ContainsRune(" +-", rune(line[0])):
+			hunk.Lines = append(hunk.Lines, line)
+		case hunk != nil && line == "":
+			// Models often drop the leading space of empty context lines
+			hunk.Lines = append(hunk.Lines, " ")
+		case strings.HasPrefix(line, "```"):
+			hunk = nil
+		}
+	}
+
+	// Trailing blank context picked up after the last hunk isn't part of it
+	for _, p := range patches {
+		for i := range p.Hunks {
+			h := &p.Hunks[i]
+			for len(h.Lines) > 0 && h.Lines[len(h.Lines)-1] == " " {
+				h.Lines = h.Lines[:len(h.Lines)-1]
+			}
+		}
+	}
+
+	if len(patches) == 0 {
+		return nil, fmt.Errorf("no file headers found in diff")
+	}
+	return patches, nil
+}
+
+// applyPatch applies a patch to content, failing unless every edit matches
+// the file exactly and unambiguously
+func applyPatch(content string, p *filePatch) (string, error) {
+	// Blocks end every line with a newline, so a file without a final one
+	// is given it while they are applied
+	missingNewline := content != "" && !strings.HasSuffix(content, "\n")
+	if missingNewline {
+		content += "\n"
+	}
+	appended := false
+	for i, b := range p.Blocks {
+		if b.Search == "" {
+			content += b.Replace
+			appended = true
+			continue
+		}
+		switch n := strings.Count(content, b.Search); n {
+		case 0:
+			return "", fmt.Errorf("%s: search block %d does not match the file", p.Path, i+1)
+		case 1:
+			content = strings.Replace(content, b.Search, b.Replace, 1)
+		default:
+			return "", fmt.Errorf("%s: search block %d matches %d places; it must be unique", p.Path, i+1, n)
+		}
+	}
+	if missingNewline && !appended {
+		content = strings.TrimSuffix(content, "\n")
+	}
+
+	if len(p.Hunks) == 0 {
+		return content, nil
+	}
+
+	lines := splitLines(content)
+	offset := 0
+	for i, h := range p.Hunks {
+		var old, new []string
+		for _, l := range h.Lines {
+			if l[0] != '+' {
+				old = append(old, l[1:])
+			}
+			if l[0] != '-' {
+				new = append(new, l[1:])
+			}
+		}
+
+		at := findHunk(lines, old, h.OldStart-1+offset)
+		if at < 0 {
+			return "", fmt.Errorf("%s: hunk %d does not apply", p.Path, i+1)
+		}
+
+		patched := append([]string(nil), lines[:at]...)
+		patched = append(patched, new...)
+		patched = append(patched, lines[at+len(old):]...)
+		lines = patched
+		offset += len(new) - len(old)
+	}
+
+	if len(lines) == 0 {
+		return "", nil
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// findHunk locates the old lines of a hunk, searching outwards from the line
+// the hunk header claims so that shifted line numbers still apply
+func findHunk(lines, old []string, want int) int {
+	matches := func(at int) bool {
+		if at < 0 || at+len(old) > len(lines) {
+			return false
+		}
+		for i, l := range old {
+			if lines[at+i] != l {
+				return false
+			}
+		}
+		return true
+	}
+
+	if len(old) == 0 {
+		return min(max(want+1, 0), len(lines))
+	}
+	for delta := 0; delta <= len(lines); delta++ {
+		if matches(want + delta) {
+			return want + delta
+		}
+		if delta > 0 && matches(want-delta) {
+			return want - delta
+		}
+	}
+	return -1
+}
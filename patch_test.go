@@ -0,0 +1,115 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestJoinBlockLines(t *testing.T) {
+	tests := []struct {
+		lines []string
+		want  string
+	}{
+		{nil, ""},
+		{[]string{"a"}, "a\n"},
+		{[]string{"a", "", "b"}, "a\n\nb\n"},
+	}
+	for _, tt := range tests {
+		if got := joinBlockLines(tt.lines); got != tt.want {
+			t.Errorf("joinBlockLines(%q) = %q, want %q", tt.lines, got, tt.want)
+		}
+	}
+}
+
+func TestParseSearchReplace(t *testing.T) {
+	response := strings.Join([]string{
+		"main.go",
+		"```go",
+		searchMarker,
+		"old",
+		dividerMarker,
+		"new",
+		replaceMarker,
+		"```",
+		"README.md",
+		searchMarker,
+		"Title",
+		dividerMarker,
+		dividerMarker,
+		"Heading",
+		dividerMarker,
+		replaceMarker,
+	}, "\n")
+	patches, err := parseSearchReplace(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(patches) != 2 {
+		t.Fatalf("%d patches, want 2", len(patches))
+	}
+	if b := patches[0].Blocks[0]; patches[0].Path != "main.go" || b.Search != "old\n" || b.Replace != "new\n" {
+		t.Errorf("main.go: %+v", patches[0])
+	}
+	if b := patches[1].Blocks[0]; b.Search != "Title\n=======\n" || b.Replace != "Heading\n=======\n" {
+		t.Errorf("README.md: %+v", patches[1])
+	}
+
+	for _, bad := range []string{
+		"a.go\n" + searchMarker + "\nold\n",
+		"a.go\n" + searchMarker + "\nold\n" + dividerMarker + "\nnew\n",
+		"a.go\n" + searchMarker + "\nold\n" + dividerMarker + "\n" + dividerMarker + "\nnew\n" + replaceMarker,
+		searchMarker + "\nold\n" + dividerMarker + "\nnew\n" + replaceMarker,
+	} {
+		if _, err := parseSearchReplace(bad); err == nil {
+			t.Errorf("%q: no error", bad)
+		}
+	}
+}
+
+func TestApplyPatchBlocks(t *testing.T) {
+	tests := []struct {
+		content string
+		blocks  []searchReplace
+		want    string
+	}{
+		{"a\nb\nc\n", []searchReplace{{"b\n", "B\n"}}, "a\nB\nc\n"},
+		// A file without a final newline matches a block ending at its
+		// last line and stays without one
+		{"a\nb", []searchReplace{{"b\n", "B\n"}}, "a\nB"},
+		{"a\nb", []searchReplace{{"a\n", "A\n"}}, "A\nb"},
+		{"a\nb", []searchReplace{{"", "c\n"}}, "a\nb\nc\n"},
+		{"", []searchReplace{{"", "new\n"}}, "new\n"},
+	}
+	for _, tt := range tests {
+		got, err := applyPatch(tt.content, &filePatch{Path: "f", Blocks: tt.blocks})
+		if err != nil {
+			t.Errorf("%q: %v", tt.content, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.content, got, tt.want)
+		}
+	}
+
+	if _, err := applyPatch("x\nx\n", &filePatch{Path: "f", Blocks: []searchReplace{{"x\n", "y\n"}}}); err == nil {
+		t.Error("ambiguous block: no error")
+	}
+	if _, err := applyPatch("x\n", &filePatch{Path: "f", Blocks: []searchReplace{{"z\n", "y\n"}}}); err == nil {
+		t.Error("missing block: no error")
+	}
+}
+
+func TestApplyPatchHunks(t *testing.T) {
+	patches, err := parseUnifiedDiff("--- a/f\n+++ b/f\n@@ -2,2 +2,2 @@\n b\n-c\n+C\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The hunk claims line 2, but the file has shifted by one line
+	got, err := applyPatch("x\na\nb\nc\n", patches[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "x\na\nb\nC\n" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// builtinPersonas are the system prompts available without any configuration.
+// Personas defined under "personas" in the config file override these.
+var builtinPersonas = map[string]string{
+	"default": defaultSystemPrompt,
+	"sre": "You are NeuroCLI, a senior site reliability engineer. Favor safe, reversible, " +
+		"observable operations. When suggesting commands, point out their blast radius, prefer " +
+		"dry-run flags where they exist and mention how to verify the result.",
+	"go-reviewer": "You are NeuroCLI, an experienced Go reviewer. Judge code against Effective Go " +
+		"and the Go Code Review Comments: clear naming, wrapped errors, small interfaces, no " +
+		"needless abstraction, correct concurrency. Be specific and cite the lines you mean.",
+	"terse": "You are NeuroCLI. Answer with the command or code only, followed by at most one " +
+		"short sentence. No preamble, no summaries.",
+}
+
+// personas returns the built-in personas merged with those from the config file
+func personas() map[string]string {
+	all := make(map[string]string, len(builtinPersonas))
+	for name, prompt := range builtinPersonas {
+		all[name] = prompt
+	}
+	for name, prompt := range viper.GetStringMapString("personas") {
+		all[name] = prompt
+	}
+	return all
+}
+
+// personaNames returns the available persona names in sorted order
+func personaNames() []string {
+	all := personas()
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// activeSystemPrompt returns the system message for this invocation: the
+// --system override if given, otherwise the selected persona, followed by
+// facts about the local environment
+func activeSystemPrompt() (string, error) {
+	system := viper.GetString("system")
+	if system == "" {
+		name := viper.GetString("persona")
+		if name == "" {
+			name = "default"
+		}
+		prompt, ok := personas()[name]
+		if !ok {
+			return "", fmt.Errorf("unknown persona %q (available: %s)", name, strings.Join(personaNames(), ", "))
+		}
+		system = prompt
+	}
+	return withEnvironment(system), nil
+}
+
+// withEnvironment appends the environment facts to a system prompt unless
+// include_environment is disabled in the config file
+func withEnvironment(system string) string {
+	if !viper.GetBool("include_environment") {
+		return system
+	}
+	return system + "\n\nThe user's environment (tailor commands to it):\n" + environmentFacts()
+}
+
+// environmentFacts describes the machine commands will run on
+func environmentFacts() string {
+	var b strings.Builder
+
+	osName := runtime.GOOS + "/" + runtime.GOARCH
+	if distro := linuxDistro(); distro != "" {
+		osName += " (" + distro + ")"
+	}
+	fmt.Fprintf(&b, "- OS: %s\n", osName)
+	fmt.Fprintf(&b, "- Shell: %s\n", userShell())
+
+	if cwd, err := os.Getwd(); err == nil {
+		fmt.Fprintf(&b, "- Working directory: %s\n", cwd)
+		if langs := detectProjectLanguages(cwd); len(langs) > 0 {
+			fmt.Fprintf(&b, "- Project language: %s\n", strings.Join(langs, ", "))
+		}
+	}
+	if branch := currentGitBranch(); branch != "" {
+		fmt.Fprintf(&b, "- Git branch: %s\n", branch)
+	}
+
+	return b.String()
+}
+
+// userShell returns the name of the user's login shell
+func userShell() string {
+	if runtime.GOOS == "windows" {
+		if comspec := os.Getenv("ComSpec"); comspec != "" {
+			return filepath.Base(comspec)
+		}
+		return "cmd.exe"
+	}
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return filepath.Base(shell)
+	}
+	return "sh"
+}
+
+// linuxDistro reads the distribution name from /etc/os-release
+func linuxDistro() string {
+	if runtime.GOOS != "linux" {
+		return ""
+	}
+	f, err := os.Open("/etc/os-release")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "PRETTY_NAME="); ok {
+			return strings.Trim(value, `"`)
+		}
+	}
+	return ""
+}
+
+// currentGitBranch returns the checked out branch, or "" outside a repository
+func currentGitBranch() string {
+	out, err := exec.Command("git", "branch", "--show-current").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// projectMarkers maps files found at a project root to the language they indicate
+var projectMarkers = []struct {
+	file     string
+	language string
+}{
+	{"go.mod", "Go"},
+	{"Cargo.toml", "Rust"},
+	{"tsconfig.json", "TypeScript"},
+	{"package.json", "JavaScript"},
+	{"pyproject.toml", "Python"},
+	{"requirements.txt", "Python"},
+	{"setup.py", "Python"},
+	{"Gemfile", "Ruby"},
+	{"pom.xml", "Java"},
+	{"build.gradle", "Java"},
+	{"build.gradle.kts", "Kotlin"},
+	{"composer.json", "PHP"},
+	{"mix.exs", "Elixir"},
+	{"CMakeLists.txt", "C/C++"},
+}
+
+// detectProjectLanguages looks for project marker files in dir and its parents,
+// stopping at the first directory that has any
+func detectProjectLanguages(dir string) []string {
+	for {
+		var langs []string
+		seen := make(map[string]bool)
+		for _, m := range projectMarkers {
+			if _, err := os.Stat(filepath.Join(dir, m.file)); err == nil && !seen[m.language] {
+				langs = append(langs, m.language)
+				seen[m.language] = true
+			}
+		}
+		if len(langs) > 0 {
+			return langs
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil
+		}
+		dir = parent
+	}
+}
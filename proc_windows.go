@@ -0,0 +1,25 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// detachProcessGroup starts cmd in its own process group
+func detachProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+// interruptProcessGroup stops p; Windows cannot deliver Ctrl-C to another
+// process group
+func interruptProcessGroup(p *os.Process) error {
+	return p.Kill()
+}
+
+// terminateProcessGroup stops p
+func terminateProcessGroup(p *os.Process) error {
+	return p.Kill()
+}
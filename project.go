@@ -0,0 +1,316 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pterm/pterm"
+	"github.com/pterm/pterm/putils"
+)
+
+// projectPrompt asks for a multi-file project as a JSON manifest
+const projectPrompt = `Generate a small, complete project based on the following description:
+
+"%s"
+
+Requirements:
+- Write in %s
+- Include every file needed to build and run it (source, build/dependency manifest, README)
+- Use relative paths with forward slashes, no absolute paths and no ".."
+- Follow language-specific best practices and conventional project layout
+- Keep it simple and focused
+
+Return ONLY a JSON object, with no surrounding text or code fences, in exactly this format:
+{"files": [{"path": "relative/path/to/file", "content": "full file content"}]}`
+
+// projectFile is one entry of the manifest returned by the model
+type projectFile struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+type projectManifest struct {
+	Files []projectFile `json:"files"`
+}
+
+// parseProjectManifest extracts the JSON manifest from a model response
+func parseProjectManifest(response string) (*projectManifest, error) {
+	start := strings.Index(response, "{")
+	end := strings.LastIndex(response, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("response does not contain a JSON manifest")
+	}
+
+	var manifest projectManifest
+	if err := json.Unmarshal([]byte(response[start:end+1]), &manifest); err != nil {
+		return nil, fmt.Errorf("invalid project manifest: %v", err)
+	}
+	if len(manifest.Files) == 0 {
+		return nil, fmt.Errorf("project manifest contains no files")
+	}
+	return &manifest, nil
+}
+
+// validateProjectPaths rejects absolute paths, paths escaping the project
+// directory (including through symlinks) and duplicate entries, and returns
+// the cleaned relative paths in manifest order
+func validateProjectPaths(root string, manifest *projectManifest) ([]string, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	realRoot := resolveExisting(absRoot)
+
+	seen := make(map[string]bool)
+	paths := make([]string, 0, len(manifest.Files))
+	for _, f := range manifest.Files {
+		raw := strings.TrimSpace(f.Path)
+		if raw == "" {
+			return nil, fmt.Errorf("manifest entry with an empty path")
+		}
+		if filepath.IsAbs(raw) || strings.HasPrefix(raw, "/") || strings.HasPrefix(raw, `\`) || filepath.VolumeName(raw) != "" {
+			return nil, fmt.Errorf("refusing absolute path %q", raw)
+		}
+
+		clean := filepath.Clean(filepath.FromSlash(raw))
+		if clean == "." || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("refusing path %q outside the project directory", raw)
+		}
+		if seen[clean] {
+			return nil, fmt.Errorf("duplicate path %q in manifest", raw)
+		}
+		seen[clean] = true
+
+		// Symlinks inside the project must not lead outside of it
+		resolved := resolveExisting(filepath.Join(absRoot, clean))
+		rel, err := filepath.Rel(realRoot, resolved)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("refusing path %q that resolves outside the project directory", raw)
+		}
+
+		paths = append(paths, clean)
+	}
+	return paths, nil
+}
+
+// resolveExisting evaluates symlinks in the longest existing prefix of path
+// and appends the components that don't exist yet
+func resolveExisting(path string) string {
+	var missing []string
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...)
+		}
+		if filepath.Dir(dir) == dir {
+			return path
+		}
+		missing = append([]string{filepath.Base(dir)}, missing...)
+	}
+}
+
+// projectTree renders the manifest paths as a tree, annotating each file
+func projectTree(root string, paths []string, notes map[string]string) (string, error) {
+	sorted := append([]string(nil), paths...)
+	sort.Strings(sorted)
+
+	list := pterm.LeveledList{}
+	emitted := make(map[string]bool)
+	for _, path := range sorted {
+		parts := strings.Split(filepath.ToSlash(path), "/")
+		for level := range parts[:len(parts)-1] {
+			dir := strings.Join(parts[:level+1], "/")
+			if !emitted[dir] {
+				list = append(list, pterm.LeveledListItem{Level: level, Text: parts[level] + "/"})
+				emitted[dir] = true
+			}
+		}
+		text := parts[len(parts)-1]
+		if note := notes[path]; note != "" {
+			text += " " + note
+		}
+		list = append(list, pterm.LeveledListItem{Level: len(parts) - 1, Text: text})
+	}
+
+	tree := putils.TreeFromLeveledList(list)
+	tree.Text = pterm.Cyan(root + "/")
+	return pterm.DefaultTree.WithRoot(tree).Srender()
+}
+
+// writeFilesAtomically stages every file next to its destination and only
+// then renames them into place, restoring the originals if any step fails
+func writeFilesAtomically(root string, paths []string, contents map[string]string) (err error) {
+	type staged struct {
+		target, temp, backup string
+		committed            bool
+	}
+	var files []staged
+	var createdDirs []string
+
+	defer func() {
+		if err == nil {
+			return
+		}
+		for i := len(files) - 1; i >= 0; i-- {
+			f := files[i]
+			if f.temp != "" {
+				os.Remove(f.temp)
+			}
+			if f.backup != "" {
+				os.Rename(f.backup, f.target)
+			} else if f.committed {
+				os.Remove(f.target)
+			}
+		}
+		for i := len(createdDirs) - 1; i >= 0; i-- {
+			os.Remove(createdDirs[i])
+		}
+	}()
+
+	for _, path := range paths {
+		target := filepath.Join(root, path)
+		dirs, err := mkdirAllTracked(filepath.Dir(target))
+		createdDirs = append(createdDirs, dirs...)
+		if err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+
+		tmp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".neurocli-*")
+		if err != nil {
+			return fmt.Errorf("failed to stage %s: %w", path, err)
+		}
+		files = append(files, staged{target: target, temp: tmp.Name()})
+		_, werr := tmp.WriteString(contents[path])
+		cerr := tmp.Close()
+		if werr != nil || cerr != nil {
+			return fmt.Errorf("failed to stage %s: %w", path, errors.Join(werr, cerr))
+		}
+		// Replaced files keep their mode, so scripts stay executable and
+		// private files private
+		mode := os.FileMode(0644)
+		if info, err := os.Stat(target); err == nil {
+			mode = info.Mode().Perm()
+		}
+		if err := os.Chmod(tmp.Name(), mode); err != nil {
+			return fmt.Errorf("failed to stage %s: %w", path, err)
+		}
+	}
+
+	for i := range files {
+		f := &files[i]
+		if _, err := os.Stat(f.target); err == nil {
+			f.backup = f.temp + ".orig"
+			if err := os.Rename(f.target, f.backup); err != nil {
+				f.backup = ""
+				return fmt.Errorf("failed to replace %s: %w", f.target, err)
+			}
+		}
+		if err := os.Rename(f.temp, f.target); err != nil {
+			return fmt.Errorf("failed to write %s: %w", f.target, err)
+		}
+		f.temp = ""
+		f.committed = true
+	}
+
+	for _, f := range files {
+		if f.backup != "" {
+			os.Remove(f.backup)
+		}
+	}
+	return nil
+}
+
+// mkdirAllTracked is os.MkdirAll that reports which directories it created
+func mkdirAllTracked(dir string) ([]string, error) {
+	var missing []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil {
+			break
+		}
+		missing = append(missing, d)
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+
+	var created []string
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := os.Mkdir(missing[i], 0755); err != nil && !os.IsExist(err) {
+			return created, err
+		}
+		created = append(created, missing[i])
+	}
+	return created, nil
+}
+
+// generateProject asks for a multi-file project, previews it and writes it to root
+func generateProject(description, language, root string, force bool) error {
+	pterm.Info.Printf("Generating %s project in %s...\n", pterm.Cyan(language), pterm.Cyan(root))
+
+	response, err := askAI(fmt.Sprintf(projectPrompt, description, language))
+	if err != nil {
+		return fmt.Errorf("failed to generate project: %w", err)
+	}
+
+	manifest, err := parseProjectManifest(response)
+	if err != nil {
+		return err
+	}
+	paths, err := validateProjectPaths(root, manifest)
+	if err != nil {
+		return err
+	}
+
+	contents := make(map[string]string, len(paths))
+	notes := make(map[string]string, len(paths))
+	var diffs []string
+	for i, path := range paths {
+		content := manifest.Files[i].Content
+		if lang, ok := languageForFile(path); ok {
+			if formatted, err := formatCode(lang, content, path); err == nil {
+				content = formatted
+			}
+		}
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		contents[path] = content
+
+		existing, err := os.ReadFile(filepath.Join(root, path))
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			notes[path] = pterm.Green("(new)")
+		case err != nil:
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		case string(existing) == content:
+			notes[path] = pterm.Gray("(unchanged)")
+		default:
+			notes[path] = pterm.Yellow("(overwrite)")
+			diffs = append(diffs, unifiedDiff("a/"+filepath.ToSlash(path), "b/"+filepath.ToSlash(path), string(existing), content))
+		}
+	}
+
+	tree, err := projectTree(root, paths, notes)
+	if err != nil {
+		return err
+	}
+	fmt.Println(tree)
+
+	for _, d := range diffs {
+		fmt.Println(colorizeDiff(d))
+	}
+	if len(diffs) > 0 && !force {
+		return fmt.Errorf("%d file(s) already exist with different content; rerun with --force to overwrite", len(diffs))
+	}
+
+	if err := writeFilesAtomically(root, paths, contents); err != nil {
+		return err
+	}
+
+	pterm.Success.Printf("✓ Wrote %d files to %s\n", len(paths), pterm.Green(root))
+	return nil
+}
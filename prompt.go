@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/pterm/pterm"
+	"github.com/spf13/viper"
+)
+
+// defaultPromptTemplate is used when shell.prompt is not configured
+const defaultPromptTemplate = `{{cwd}}{{git}} {{model}}{{status}}
+> `
+
+// gitStatusTTL is how long the dirty state of a repository is cached
+const gitStatusTTL = 2 * time.Second
+
+var (
+	promptCwdStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("39")).Bold(true)
+	promptGitStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("141"))
+	promptDirtyStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("214"))
+	promptModelStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("245"))
+	promptStatusStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("203"))
+
+	// lastExitStatus is the exit status of the last command run from the shell
+	lastExitStatus int
+
+	promptTemplateOnce sync.Once
+	promptTemplate     *template.Template
+
+	gitDirtyCache struct {
+		dir     string
+		dirty   bool
+		checked time.Time
+	}
+)
+
+// getPrompt renders the configured prompt template. liner cannot measure
+// styled text, so every line but the last is printed directly and only the
+// last line, stripped of styling, is returned as the prompt.
+func getPrompt() string {
+	promptTemplateOnce.Do(func() {
+		text := viper.GetString("shell.prompt")
+		if text == "" {
+			text = defaultPromptTemplate
+		}
+		t, err := template.New("prompt").Funcs(promptFuncs()).Parse(text)
+		if err != nil {
+			pterm.Warning.Printf("Invalid shell.prompt, using the default: %v\n", err)
+			t = template.Must(template.New("prompt").Funcs(promptFuncs()).Parse(defaultPromptTemplate))
+		}
+		promptTemplate = t
+	})
+
+	var b bytes.Buffer
+	if err := promptTemplate.Execute(&b, nil); err != nil {
+		return "> "
+	}
+	lines := strings.Split(b.String(), "\n")
+	for _, l := range lines[:len(lines)-1] {
+		os.Stdout.WriteString(l + "\n")
+	}
+	return ansi.Strip(lines[len(lines)-1])
+}
+
+// promptFuncs returns the segments available to the prompt template
+func promptFuncs() template.FuncMap {
+	return template.FuncMap{
+		"cwd": func() string {
+			return promptCwdStyle.Render(abbreviatePath(currentDir()))
+		},
+		"git": func() string {
+			branch, dir := gitPromptBranch(currentDir())
+			if branch == "" {
+				return ""
+			}
+			s := " " + promptGitStyle.Render(branch)
+			if gitDirty(dir) {
+				s += promptDirtyStyle.Render("*")
+			}
+			return s
+		},
+		"branch": func() string {
+			branch, _ := gitPromptBranch(currentDir())
+			return branch
+		},
+		"provider": func() string {
+			return viper.GetString("provider")
+		},
+		"model": func() string {
+			p, err := activeProvider()
+			if err != nil {
+				return ""
+			}
+			return promptModelStyle.Render(p.Name + "/" + activeModel(p))
+		},
+		"status": func() string {
+			if lastExitStatus == 0 {
+				return ""
+			}
+			return " " + promptStatusStyle.Render("["+strconv.Itoa(lastExitStatus)+"]")
+		},
+		"exitCode": func() int {
+			return lastExitStatus
+		},
+		"style": func(color, text string) string {
+			return lipgloss.NewStyle().Foreground(lipgloss.Color(color)).Render(text)
+		},
+	}
+}
+
+// currentDir returns the working directory, or "?" if it was removed
+func currentDir() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "?"
+	}
+	return dir
+}
+
+// abbreviatePath shortens dir for the prompt: the home directory becomes ~
+// and only the last two path elements are kept
+func abbreviatePath(dir string) string {
+	if home, err := os.UserHomeDir(); err == nil {
+		if dir == home {
+			return "~"
+		}
+		if strings.HasPrefix(dir, home+string(filepath.Separator)) {
+			dir = "~" + dir[len(home):]
+		}
+	}
+	parts := strings.Split(dir, string(filepath.Separator))
+	if len(parts) > 3 {
+		return filepath.Join("…", parts[len(parts)-2], parts[len(parts)-1])
+	}
+	return dir
+}
+
+// gitPromptBranch returns the current branch, or the short commit when HEAD
+// is detached, by reading .git/HEAD directly instead of running git. It also
+// returns the repository's working directory.
+func gitPromptBranch(dir string) (string, string) {
+	dotGit := findUp(dir, ".git")
+	if dotGit == "" {
+		return "", ""
+	}
+	gitDir := dotGit
+	if info, err := os.Stat(dotGit); err == nil && !info.IsDir() {
+		data, err := os.ReadFile(dotGit)
+		if err != nil {
+			return "", ""
+		}
+		gitDir = strings.TrimSpace(strings.TrimPrefix(string(data), "gitdir:"))
+		if !filepath.IsAbs(gitDir) {
+			gitDir = filepath.Join(filepath.Dir(dotGit), gitDir)
+		}
+	}
+
+	head, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return "", ""
+	}
+	ref := strings.TrimSpace(string(head))
+	if branch, ok := strings.CutPrefix(ref, "ref: refs/heads/"); ok {
+		return branch, filepath.Dir(dotGit)
+	}
+	if len(ref) > 7 {
+		ref = ref[:7]
+	}
+	return ref, filepath.Dir(dotGit)
+}
+
+// gitDirty reports whether the repository has uncommitted changes to
+// tracked files. The answer is cached briefly and the check is abandoned
+// if it takes too long, so large repositories don't slow the prompt down.
+func gitDirty(dir string) bool {
+	c := &gitDirtyCache
+	if c.dir == dir && time.Since(c.checked) < gitStatusTTL {
+		return c.dirty
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", "status", "--porcelain", "--untracked-files=no")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+
+	c.dir, c.checked = dir, time.Now()
+	c.dirty = err == nil && len(bytes.TrimSpace(out)) > 0
+	return c.dirty
+}
+
+// recordExitStatus remembers the exit status of a command run from the
+// shell for the prompt and returns err unchanged. The command may have
+// changed the repository, so the cached dirty state is dropped.
+func recordExitStatus(err error) error {
+	lastExitStatus = exitCode(err)
+	gitDirtyCache.checked = time.Time{}
+	return err
+}
+
+// exitCode converts the error from running a command into its exit status
+func exitCode(err error) int {
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &exitErr):
+		return exitErr.ExitCode()
+	}
+	return 1
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Provider describes an OpenAI-compatible chat completion endpoint
+type Provider struct {
+	Name         string
+	URL          string
+	ModelsURL    string
+	DefaultModel string
+	KeyEnv       string
+	KeyRequired  bool
+}
+
+// providers lists the chat endpoints NeuroCLI knows how to talk to
+var providers = map[string]Provider{
+	"pollinations": {
+		Name:         "pollinations",
+		URL:          apiURL,
+		ModelsURL:    "https://text.pollinations.ai/models",
+		DefaultModel: "openai",
+		KeyEnv:       "POLLINATIONS_API_KEY",
+	},
+	"openai": {
+		Name:         "openai",
+		URL:          "https://api.openai.com/v1/chat/completions",
+		ModelsURL:    "https://api.openai.com/v1/models",
+		DefaultModel: "gpt-4o-mini",
+		KeyEnv:       "OPENAI_API_KEY",
+		KeyRequired:  true,
+	},
+	"openrouter": {
+		Name:         "openrouter",
+		URL:          "https://openrouter.ai/api/v1/chat/completions",
+		ModelsURL:    "https://openrouter.ai/api/v1/models",
+		DefaultModel: "openai/gpt-4o-mini",
+		KeyEnv:       "OPENROUTER_API_KEY",
+		KeyRequired:  true,
+	},
+	"groq": {
+		Name:         "groq",
+		URL:          "https://api.groq.com/openai/v1/chat/completions",
+		ModelsURL:    "https://api.groq.com/openai/v1/models",
+		DefaultModel: "llama-3.1-8b-instant",
+		KeyEnv:       "GROQ_API_KEY",
+		KeyRequired:  true,
+	},
+}
+
+// providerNames returns the known provider names in sorted order
+func providerNames() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupProvider returns the provider registered under name
+func lookupProvider(name string) (Provider, error) {
+	p, ok := providers[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return Provider{}, fmt.Errorf("unknown provider %q (available: %s)", name, strings.Join(providerNames(), ", "))
+	}
+	return p, nil
+}
+
+// activeProvider returns the provider selected by --provider or the config file
+func activeProvider() (Provider, error) {
+	return lookupProvider(viper.GetString("provider"))
+}
+
+// activeModel returns the configured model, falling back to the provider default
+func activeModel(p Provider) string {
+	if model := viper.GetString("model"); model != "" {
+		return model
+	}
+	return p.DefaultModel
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/viper"
+)
+
+// Redaction modes set with --redact or redaction.mode in the config file
+const (
+	redactMask   = "mask"
+	redactStrict = "strict"
+	redactOff    = "off"
+)
+
+// redactionDetector finds one kind of sensitive value. When the pattern has a
+// capture group only the first group is masked, so "password=hunter22"
+// becomes "password=[REDACTED:generic-secret]".
+type redactionDetector struct {
+	Name    string
+	Pattern *regexp.Regexp
+	Check   func(string) bool
+}
+
+// builtinDetectors run before any custom patterns from the config file
+var builtinDetectors = []redactionDetector{
+	{
+		Name:    "private-key",
+		Pattern: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+	},
+	{
+		Name:    "aws-access-key",
+		Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+	},
+	{
+		Name:    "aws-secret-key",
+		Pattern: regexp.MustCompile(`(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+=]{40})`),
+	},
+	{
+		Name:    "github-token",
+		Pattern: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,255}|github_pat_[A-Za-z0-9_]{22,255})\b`),
+	},
+	{
+		Name:    "jwt",
+		Pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{5,}\.eyJ[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]{5,}`),
+	},
+	{
+		Name:    "generic-secret",
+		Pattern: regexp.MustCompile(`(?im)\b[a-z0-9_]*(?:password|passwd|secret|token|api_?key)["']?\s*(?::=|[:=])\s*["']?([^\s"'(),;]{8,})(?:["'\s,;]|$)`),
+	},
+	{
+		Name:    "email",
+		Pattern: regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`),
+	},
+	{
+		Name:    "high-entropy",
+		Pattern: regexp.MustCompile(`[A-Za-z0-9+/=_-]{20,}`),
+		Check:   isHighEntropy,
+	},
+}
+
+// redactionReport counts the values masked by each detector
+type redactionReport map[string]int
+
+// Total returns the number of masked values
+func (r redactionReport) Total() int {
+	total := 0
+	for _, n := range r {
+		total += n
+	}
+	return total
+}
+
+// String renders the report as "name ×count" pairs in a stable order
+func (r redactionReport) String() string {
+	names := make([]string, 0, len(r))
+	for name := range r {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s ×%d", name, r[name]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// redactionDetectors returns the enabled built-in detectors followed by the
+// custom patterns configured under redaction.patterns
+func redactionDetectors() ([]redactionDetector, error) {
+	disabled := make(map[string]bool)
+	for _, name := range viper.GetStringSlice("redaction.disable") {
+		disabled[name] = true
+	}
+
+	var detectors []redactionDetector
+	for _, d := range builtinDetectors {
+		if !disabled[d.Name] {
+			detectors = append(detectors, d)
+		}
+	}
+
+	var custom []struct {
+		Name    string `mapstructure:"name"`
+		Pattern string `mapstructure:"pattern"`
+	}
+	if err := viper.UnmarshalKey("redaction.patterns", &custom); err != nil {
+		return nil, fmt.Errorf("invalid redaction.patterns: %v", err)
+	}
+	for i, c := range custom {
+		re, err := regexp.Compile(c.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %v", c.Pattern, err)
+		}
+		name := c.Name
+		if name == "" {
+			name = fmt.Sprintf("custom-%d", i+1)
+		}
+		detectors = append(detectors, redactionDetector{Name: name, Pattern: re})
+	}
+
+	return detectors, nil
+}
+
+// redactText masks sensitive values in text and reports what was masked
+func redactText(text string) (string, redactionReport, error) {
+	report := make(redactionReport)
+
+	detectors, err := redactionDetectors()
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Stored credentials are masked first, whatever they look like
+	for _, secret := range registeredSecrets() {
+		if n := strings.Count(text, secret); n > 0 {
+			text = strings.ReplaceAll(text, secret, "[REDACTED:credential]")
+			report["credential"] += n
+		}
+	}
+	for _, d := range detectors {
+		text = applyDetector(text, d, report)
+	}
+	return text, report, nil
+}
+
+// applyDetector replaces every match of a detector with a placeholder
+func applyDetector(text string, d redactionDetector, report redactionReport) string {
+	matches := d.Pattern.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return text
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if len(m) >= 4 && m[2] >= 0 {
+			start, end = m[2], m[3]
+		}
+
+		value := text[start:end]
+		if strings.HasPrefix(value, "[REDACTED") || (d.Check != nil && !d.Check(value)) {
+			continue
+		}
+
+		b.WriteString(text[last:start])
+		b.WriteString("[REDACTED:" + d.Name + "]")
+		last = end
+		report[d.Name]++
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// isHighEntropy flags random-looking tokens such as API keys while leaving
+// words, identifiers and hex digests (commit hashes) alone
+func isHighEntropy(s string) bool {
+	var hasUpper, hasLower, hasDigit, onlyHex = false, false, false, true
+	for _, r := range s {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			hasUpper = true
+		case r >= 'a' && r <= 'z':
+			hasLower = true
+		case r >= '0' && r <= '9':
+			hasDigit = true
+		}
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			onlyHex = false
+		}
+	}
+	if onlyHex || !(hasUpper && hasLower && hasDigit) {
+		return false
+	}
+	return shannonEntropy(s) >= 4.2
+}
+
+// shannonEntropy returns the entropy of s in bits per character
+func shannonEntropy(s string) float64 {
+	counts := make(map[rune]int)
+	for _, r := range s {
+		counts[r]++
+	}
+	n := float64(len([]rune(s)))
+	entropy := 0.0
+	for _, c := range counts {
+		p := float64(c) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// redactOutgoing applies the configured redaction mode to content about to be
+// sent to the model. Strict mode refuses to send anything that needed masking.
+func redactOutgoing(text string) (string, error) {
+	mode := strings.ToLower(viper.GetString("redaction.mode"))
+	switch mode {
+	case redactOff:
+		return text, nil
+	case "", redactMask, redactStrict:
+	default:
+		return "", fmt.Errorf("unknown redaction mode %q (use mask, strict or off)", mode)
+	}
+
+	redacted, report, err := redactText(text)
+	if err != nil {
+		return "", err
+	}
+	if report.Total() == 0 {
+		return text, nil
+	}
+
+	if mode == redactStrict {
+		return "", fmt.Errorf("refusing to send content containing sensitive values (%s); remove them or use --redact=mask", report)
+	}
+	// stdout may be parsed, as with neurocli suggest and cmd --json
+	pterm.Warning.WithWriter(os.Stderr).Printf("Redacted %d sensitive value(s) before sending: %s\n", report.Total(), report)
+	return redacted, nil
+}
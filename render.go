@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2/quick"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/lipgloss/table"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/muesli/termenv"
+	"golang.org/x/term"
+)
+
+// highlightStyle is the chroma style used for code blocks
+const highlightStyle = "monokai"
+
+var (
+	headingStyles = []lipgloss.Style{
+		lipgloss.NewStyle().Bold(true).Underline(true).Foreground(lipgloss.Color("63")),
+		lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("39")),
+		lipgloss.NewStyle().Bold(true),
+	}
+	inlineCodeStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("203")).Background(lipgloss.Color("236"))
+	boldStyle       = lipgloss.NewStyle().Bold(true)
+	italicStyle     = lipgloss.NewStyle().Italic(true)
+	linkStyle       = lipgloss.NewStyle().Underline(true).Foreground(lipgloss.Color("39"))
+	quoteStyle      = lipgloss.NewStyle().Foreground(lipgloss.Color("245"))
+	bulletStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("63"))
+	codeLabelStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("241"))
+
+	headingPattern    = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	listPattern       = regexp.MustCompile(`^(\s*)([-*+]|\d+[.)])\s+(.*)$`)
+	rulePattern       = regexp.MustCompile(`^\s*(-\s*){3,}$|^\s*(\*\s*){3,}$|^\s*(_\s*){3,}$`)
+	tableRulePattern  = regexp.MustCompile(`^\s*\|?\s*:?-{3,}:?\s*(\|\s*:?-{3,}:?\s*)*\|?\s*$`)
+	inlineCodePattern = regexp.MustCompile("`([^`]+)`")
+	boldPattern       = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	italicPattern     = regexp.MustCompile(`\*([^*\s][^*]*)\*|\b_([^_\s][^_]*)_\b`)
+	linkPattern       = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+)
+
+// colorProfile returns the color profile of stdout. It is Ascii when stdout
+// is not a terminal or NO_COLOR is set.
+func colorProfile() termenv.Profile {
+	return termenv.NewOutput(os.Stdout).EnvColorProfile()
+}
+
+// terminalWidth returns the width of stdout, capped to keep prose readable
+func terminalWidth() int {
+	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width <= 0 {
+		return 80
+	}
+	return min(width, 120)
+}
+
+// printMarkdown prints a model response, rendered for the terminal when
+// stdout supports it
+func printMarkdown(markdown string) {
+	fmt.Println(renderMarkdown(markdown, false))
+}
+
+// renderMarkdown renders Markdown with styled headings, lists, tables and
+// inline markup and syntax-highlighted code blocks. The text is returned
+// unchanged when stdout is not a color terminal. With numbered set, code
+// blocks are labeled [1], [2], ... so they can be referred to afterwards.
+func renderMarkdown(markdown string, numbered bool) string {
+	profile := colorProfile()
+	if profile == termenv.Ascii && !numbered {
+		return strings.TrimRight(markdown, "\n")
+	}
+	width := terminalWidth()
+
+	var out []string
+	n := 0
+	for _, segment := range splitMarkdown(markdown) {
+		if segment.Block == nil {
+			if profile == termenv.Ascii {
+				out = append(out, segment.Text)
+			} else {
+				out = append(out, renderProse(segment.Text, width))
+			}
+			continue
+		}
+
+		label := segment.Block.Lang
+		if numbered {
+			n++
+			label = strings.TrimSpace(fmt.Sprintf("[%d] %s", n, label))
+		}
+		if profile == termenv.Ascii {
+			out = append(out, fmt.Sprintf("%s\n```%s\n%s\n```\n", label, segment.Block.Lang, segment.Block.Code))
+		} else {
+			out = append(out, renderCodeBlock(*segment.Block, label, profile))
+		}
+	}
+	return strings.TrimRight(strings.Join(out, "\n"), "\n")
+}
+
+// renderCodeBlock highlights a code block under the given label
+func renderCodeBlock(block codeBlock, label string, profile termenv.Profile) string {
+	var b strings.Builder
+	if label != "" {
+		b.WriteString(codeLabelStyle.Render(label) + "\n")
+	}
+	var code strings.Builder
+	if err := quick.Highlight(&code, block.Code, block.Lang, chromaFormatter(profile), highlightStyle); err != nil {
+		code.Reset()
+		code.WriteString(block.Code)
+	}
+	for _, line := range strings.Split(strings.TrimRight(code.String(), "\n"), "\n") {
+		b.WriteString("  " + line + "\n")
+	}
+	return b.String()
+}
+
+// chromaFormatter picks the chroma terminal formatter for a color profile
+func chromaFormatter(profile termenv.Profile) string {
+	switch profile {
+	case termenv.TrueColor:
+		return "terminal16m"
+	case termenv.ANSI256:
+		return "terminal256"
+	default:
+		return "terminal16"
+	}
+}
+
+// renderProse renders the Markdown between code blocks line by line
+func renderProse(text string, width int) string {
+	lines := strings.Split(text, "\n")
+	var out []string
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		if isTableRow(line) && i+1 < len(lines) && tableRulePattern.MatchString(lines[i+1]) {
+			rows := [][]string{tableCells(line)}
+			i += 2
+			for ; i < len(lines) && isTableRow(lines[i]); i++ {
+				rows = append(rows, tableCells(lines[i]))
+			}
+			i--
+			out = append(out, renderTable(rows, width))
+			continue
+		}
+
+		switch {
+		case headingPattern.MatchString(line):
+			m := headingPattern.FindStringSubmatch(line)
+			style := headingStyles[min(len(m[1]), len(headingStyles))-1]
+			out = append(out, style.Render(m[2]))
+		case rulePattern.MatchString(line):
+			out = append(out, quoteStyle.Render(strings.Repeat("─", width)))
+		case listPattern.MatchString(line):
+			m := listPattern.FindStringSubmatch(line)
+			marker := m[2]
+			if !strings.ContainsAny(marker, "0123456789") {
+				marker = "•"
+			}
+			indent := m[1] + "  "
+			prefix := indent + bulletStyle.Render(marker) + " "
+			out = append(out, hangingWrap(renderInline(m[3]), prefix, strings.Repeat(" ", len(indent)+ansi.StringWidth(marker)+1), width))
+		case strings.HasPrefix(strings.TrimSpace(line), ">"):
+			quoted := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), ">"))
+			prefix := quoteStyle.Render("│ ")
+			out = append(out, hangingWrap(quoteStyle.Render(quoted), prefix, prefix, width))
+		default:
+			out = append(out, ansi.Wordwrap(renderInline(line), width, ""))
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// hangingWrap wraps text to width, starting with prefix and indenting
+// continuation lines with indent
+func hangingWrap(text, prefix, indent string, width int) string {
+	limit := max(width-ansi.StringWidth(indent), 20)
+	wrapped := strings.Split(ansi.Wordwrap(text, limit, ""), "\n")
+	for i := range wrapped {
+		if i == 0 {
+			wrapped[i] = prefix + wrapped[i]
+		} else {
+			wrapped[i] = indent + wrapped[i]
+		}
+	}
+	return strings.Join(wrapped, "\n")
+}
+
+// renderInline styles inline code, emphasis and links within one line
+func renderInline(text string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range inlineCodePattern.FindAllStringSubmatchIndex(text, -1) {
+		b.WriteString(renderEmphasis(text[last:loc[0]]))
+		b.WriteString(inlineCodeStyle.Render(text[loc[2]:loc[3]]))
+		last = loc[1]
+	}
+	b.WriteString(renderEmphasis(text[last:]))
+	return b.String()
+}
+
+// renderEmphasis styles bold, italic and link markup outside inline code
+func renderEmphasis(text string) string {
+	text = linkPattern.ReplaceAllStringFunc(text, func(s string) string {
+		m := linkPattern.FindStringSubmatch(s)
+		return m[1] + " (" + linkStyle.Render(m[2]) + ")"
+	})
+	text = boldPattern.ReplaceAllStringFunc(text, func(s string) string {
+		m := boldPattern.FindStringSubmatch(s)
+		return boldStyle.Render(m[1] + m[2])
+	})
+	return italicPattern.ReplaceAllStringFunc(text, func(s string) string {
+		m := italicPattern.FindStringSubmatch(s)
+		return italicStyle.Render(m[1] + m[2])
+	})
+}
+
+// isTableRow reports whether line looks like a Markdown table row
+func isTableRow(line string) bool {
+	line = strings.TrimSpace(line)
+	return strings.HasPrefix(line, "|") && strings.Count(line, "|") >= 2
+}
+
+// tableCells splits a Markdown table row into its cells
+func tableCells(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimSuffix(strings.TrimPrefix(line, "|"), "|")
+	cells := strings.Split(line, "|")
+	for i, cell := range cells {
+		cells[i] = renderInline(strings.TrimSpace(cell))
+	}
+	return cells
+}
+
+// renderTable draws a Markdown table, shrinking it to width if needed
+func renderTable(rows [][]string, width int) string {
+	t := table.New().
+		Border(lipgloss.RoundedBorder()).
+		BorderStyle(lipgloss.NewStyle().Foreground(lipgloss.Color("63"))).
+		Headers(rows[0]...).
+		Rows(rows[1:]...)
+
+	rendered := t.Render()
+	if ansi.StringWidth(strings.SplitN(rendered, "\n", 2)[0]) > width {
+		rendered = t.Width(width).Render()
+	}
+	return rendered
+}
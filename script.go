@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// scriptVarPattern matches a {{name}} reference to a script variable
+var scriptVarPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_]\w*)\s*\}\}`)
+
+// scriptSetPattern matches a "set name=value" line in a script
+var scriptSetPattern = regexp.MustCompile(`^set\s+([A-Za-z_]\w*)=(.*)$`)
+
+var (
+	// assumeYes answers every confirmation with yes, as with run --yes
+	assumeYes bool
+	// dryRun shows commands instead of running them, as with run --dry-run
+	dryRun bool
+	// transcript receives a Markdown record of a script run; nil when off
+	transcript io.Writer
+)
+
+// scriptOptions control how runScript runs a script
+type scriptOptions struct {
+	Vars      map[string]string
+	KeepGoing bool
+}
+
+func newRunCmd() *cobra.Command {
+	var (
+		opts           scriptOptions
+		transcriptPath string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "run SCRIPT",
+		Short: "Run a file of shell lines non-interactively",
+		Long: `Run a script of interactive shell lines: prompts for the AI, ! commands and
+built-ins, one per line. Lines starting with # are comments, and """ blocks
+and trailing backslashes work as in the shell.
+
+"set name=value" defines a variable and {{name}} is replaced by its value.
+--var takes precedence over set, so a script can set defaults. The script
+stops at the first failing line unless --keep-going is given. Use - to read
+the script from standard input.`,
+		Example: `  neurocli run release.neuro
+  neurocli run --var version=1.4.0 --yes release.neuro
+  neurocli run --dry-run --transcript review.md review.neuro`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var r io.Reader = os.Stdin
+			name := "stdin"
+			if args[0] != "-" {
+				f, err := os.Open(args[0])
+				if err != nil {
+					return fmt.Errorf("failed to open script: %w", err)
+				}
+				defer f.Close()
+				r, name = f, args[0]
+			}
+
+			if transcriptPath != "" {
+				f, err := os.Create(transcriptPath)
+				if err != nil {
+					return fmt.Errorf("failed to create transcript: %w", err)
+				}
+				defer f.Close()
+				transcript = f
+				defer func() { transcript = nil }()
+			}
+
+			return runScript(r, name, opts)
+		},
+	}
+
+	cmd.Flags().StringToStringVar(&opts.Vars, "var", nil, "set a script variable (name=value)")
+	cmd.RegisterFlagCompletionFunc("var", cobra.NoFileCompletions)
+	cmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "run commands that would ask for confirmation")
+	cmd.Flags().BoolVarP(&dryRun, "dry-run", "n", false, "show commands and file writes instead of running them")
+	cmd.Flags().BoolVarP(&opts.KeepGoing, "keep-going", "k", false, "continue after a failing line")
+	cmd.Flags().StringVarP(&transcriptPath, "transcript", "t", "", "write a Markdown transcript of the run to a file")
+	return cmd
+}
+
+// runScript runs shell lines read from r until the end of input or the exit
+// built-in. Each line is echoed before it runs. It stops at the first
+// failing line unless opts.KeepGoing is set, and then reports how many failed.
+func runScript(r io.Reader, name string, opts scriptOptions) error {
+	registerShellPlugins()
+
+	// Commands started from a script read on stdin would consume the rest
+	// of it, so they get the null device instead; r keeps the real stdin
+	if r == io.Reader(os.Stdin) {
+		devNull, err := os.Open(os.DevNull)
+		if err != nil {
+			return err
+		}
+		defer devNull.Close()
+		stdin := os.Stdin
+		os.Stdin = devNull
+		defer func() { os.Stdin = stdin }()
+	}
+
+	vars := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNo := 0
+	next := func() (string, error) {
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return "", err
+			}
+			return "", io.ErrUnexpectedEOF
+		}
+		lineNo++
+		return scanner.Text(), nil
+	}
+
+	failed := 0
+	exitShell = false
+	for !exitShell && scanner.Scan() {
+		lineNo++
+		start := lineNo
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		input, err := continueInput(text, next)
+		if err != nil {
+			return fmt.Errorf("%s:%d: unterminated input: %v", name, start, err)
+		}
+
+		if m := scriptSetPattern.FindStringSubmatch(input); m != nil {
+			vars[m[1]] = strings.TrimSpace(m[2])
+			continue
+		}
+		input, err = expandScriptVars(input, opts.Vars, vars)
+		if err == nil {
+			fmt.Println(pterm.Cyan("> " + input))
+			writeTranscript("## `%s`\n\n", strings.ReplaceAll(input, "\n", " "))
+			err = processLine(input, false)
+			// A prompt composed with the edit built-in runs right away
+			if err == nil && pendingInput != "" {
+				input, pendingInput = pendingInput, ""
+				err = processLine(input, true)
+			}
+		}
+		if err != nil {
+			failed++
+			pterm.Error.Printf("%s:%d: %v\n", name, start, err)
+			writeTranscript("**Error:** %v\n\n", err)
+			if !opts.KeepGoing {
+				return fmt.Errorf("%s stopped at line %d", name, start)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %v", name, err)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d line(s) of %s failed", failed, name)
+	}
+	return nil
+}
+
+// expandScriptVars replaces {{name}} references in input. Variables given
+// on the command line win over those set in the script.
+func expandScriptVars(input string, flags, vars map[string]string) (string, error) {
+	var missing []string
+	expanded := scriptVarPattern.ReplaceAllStringFunc(input, func(ref string) string {
+		name := scriptVarPattern.FindStringSubmatch(ref)[1]
+		if value, ok := flags[name]; ok {
+			return value
+		}
+		if value, ok := vars[name]; ok {
+			return value
+		}
+		missing = append(missing, name)
+		return ref
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("undefined variable %s", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+// skipDryRun reports whether an action must be skipped because of
+// --dry-run, showing what would have happened
+func skipDryRun(action string) bool {
+	if !dryRun {
+		return false
+	}
+	pterm.Info.Println("Dry run, would " + action)
+	writeTranscript("*Dry run, would %s*\n\n", action)
+	return true
+}
+
+// writeTranscript appends to the transcript if one is being recorded
+func writeTranscript(format string, args ...any) {
+	if transcript != nil {
+		fmt.Fprintf(transcript, format, args...)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpandScriptVars(t *testing.T) {
+	flags := map[string]string{"version": "1.4.0"}
+	vars := map[string]string{"version": "0.0.1", "name": "neurocli"}
+	tests := []struct {
+		input, want string
+	}{
+		{"release {{version}}", "release 1.4.0"},
+		{"{{ name }}-{{version}}", "neurocli-1.4.0"},
+		{"no variables", "no variables"},
+		{"{not} {{ }}", "{not} {{ }}"},
+	}
+	for _, tt := range tests {
+		got, err := expandScriptVars(tt.input, flags, vars)
+		if err != nil {
+			t.Errorf("%q: %v", tt.input, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("expandScriptVars(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	_, err := expandScriptVars("{{missing}} and {{other}}", flags, vars)
+	if err == nil || !strings.Contains(err.Error(), "missing, other") {
+		t.Errorf("undefined variables: %v", err)
+	}
+}
+
+func TestRunScriptFromStdin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	silenceStdout(t)
+	out := filepath.Join(t.TempDir(), "out")
+
+	// cat would read the rest of the script if it inherited stdin, so
+	// the rest arrives only once cat is running
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteString("!cat\n")
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		w.WriteString("!echo after > " + out + "\n")
+		w.Close()
+	}()
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = stdin }()
+
+	assumeYes = true
+	defer func() { assumeYes = false }()
+	if err := runScript(os.Stdin, "stdin", scriptOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if os.Stdin != r {
+		t.Error("stdin was not put back")
+	}
+	if data, err := os.ReadFile(out); err != nil || string(data) != "after\n" {
+		t.Errorf("second line: %q, %v", data, err)
+	}
+}
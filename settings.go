@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/viper"
+)
+
+// Settings changed with these built-ins last until the shell exits; the
+// config file and flags are left alone.
+
+// handleStatus shows the settings used for the next prompt
+func handleStatus(args []string) error {
+	provider, err := activeProvider()
+	if err != nil {
+		return err
+	}
+
+	keyStatus := "not needed"
+	if _, source, err := resolveAPIKey(provider); err != nil {
+		keyStatus = "error: " + err.Error()
+	} else if source != "" {
+		keyStatus = source
+	} else if provider.KeyRequired {
+		keyStatus = "missing"
+	}
+
+	persona := viper.GetString("persona")
+	if viper.GetString("system") != "" {
+		persona = "custom system prompt"
+	}
+
+	t := newShellTable("SETTING", "VALUE")
+	t.Row("Provider", provider.Name)
+	t.Row("Model", activeModel(provider))
+	t.Row("Temperature", strconv.FormatFloat(viper.GetFloat64("temperature"), 'g', -1, 64))
+	t.Row("Max tokens", strconv.Itoa(viper.GetInt("max_tokens")))
+	t.Row("Persona", persona)
+	t.Row("Redaction", viper.GetString("redaction.mode"))
+	t.Row("API key", keyStatus)
+	t.Row("Directory", currentDir())
+	fmt.Println(t.Render())
+	return nil
+}
+
+// handleProvider switches the provider. A model chosen for the previous
+// provider rarely exists on the new one, so the model is reset to the
+// provider's default.
+func handleProvider(args []string) error {
+	if len(args) == 0 {
+		fmt.Println(viper.GetString("provider"))
+		return nil
+	}
+	p, err := lookupProvider(args[0])
+	if err != nil {
+		return err
+	}
+	if p.KeyRequired {
+		if key, _, err := resolveAPIKey(p); err != nil || key == "" {
+			pterm.Warning.Printf("No API key for %s; run 'neurocli auth login --provider %s'\n", p.Name, p.Name)
+		}
+	}
+	viper.Set("provider", p.Name)
+	viper.Set("model", "")
+	pterm.Success.Printf("✓ Provider set to %s (model %s)\n", pterm.Cyan(p.Name), pterm.Cyan(p.DefaultModel))
+	return nil
+}
+
+// handleModel switches the model of the current provider
+func handleModel(args []string) error {
+	p, err := activeProvider()
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		fmt.Println(activeModel(p))
+		return nil
+	}
+	viper.Set("model", args[0])
+	pterm.Success.Printf("✓ Model set to %s\n", pterm.Cyan(args[0]))
+	return nil
+}
+
+// handleTemperature sets the sampling temperature
+func handleTemperature(args []string) error {
+	if len(args) == 0 {
+		fmt.Println(viper.GetFloat64("temperature"))
+		return nil
+	}
+	temp, err := strconv.ParseFloat(args[0], 64)
+	if err != nil || temp < 0 || temp > 2 {
+		return fmt.Errorf("temperature must be a number between 0 and 2")
+	}
+	viper.Set("temperature", temp)
+	pterm.Success.Printf("✓ Temperature set to %g\n", temp)
+	return nil
+}
+
+// handleTokens sets the maximum number of tokens per answer
+func handleTokens(args []string) error {
+	if len(args) == 0 {
+		fmt.Println(viper.GetInt("max_tokens"))
+		return nil
+	}
+	tokens, err := strconv.Atoi(args[0])
+	if err != nil || tokens <= 0 {
+		return fmt.Errorf("max tokens must be a positive number")
+	}
+	viper.Set("max_tokens", tokens)
+	pterm.Success.Printf("✓ Max tokens set to %d\n", tokens)
+	return nil
+}
+
+// handlePersona switches the persona, replacing any --system prompt
+func handlePersona(args []string) error {
+	if len(args) == 0 {
+		fmt.Println(viper.GetString("persona"))
+		return nil
+	}
+	if _, ok := personas()[args[0]]; !ok {
+		return fmt.Errorf("unknown persona %q (available: %s)", args[0], strings.Join(personaNames(), ", "))
+	}
+	viper.Set("persona", args[0])
+	viper.Set("system", "")
+	pterm.Success.Printf("✓ Persona set to %s\n", pterm.Cyan(args[0]))
+	return nil
+}
+
+// completeProviders completes provider names
+func completeProviders(args []string, word string) []string {
+	return completeFrom(providerNames(), args, word)
+}
+
+// completePersonas completes persona names
+func completePersonas(args []string, word string) []string {
+	return completeFrom(personaNames(), args, word)
+}
+
+// completeFrom completes the first argument from a fixed list of names
+func completeFrom(names, args []string, word string) []string {
+	if len(args) > 0 {
+		return nil
+	}
+	var c []string
+	for _, name := range names {
+		if strings.HasPrefix(name, word) {
+			c = append(c, name)
+		}
+	}
+	return c
+}
@@ -2,9 +2,10 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
-	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
 
@@ -12,6 +13,8 @@ import (
 	"github.com/charmbracelet/lipgloss/table"
 	"github.com/peterh/liner"
 	"github.com/pterm/pterm"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
 )
 
 // _---~~(~~-_.
@@ -25,208 +28,401 @@ import (
 //                `\  }
 //                  { }      Neurocli
 
+// ShellCommand is a shell built-in. It runs as /name, or as a bare name
+// when its arguments fit MinArgs, MaxArgs and ArgPattern.
 type ShellCommand struct {
 	Name        string
+	Aliases     []string
+	Usage       string
 	Description string
 	Handler     func([]string) error
+	// Complete returns completions for the word being typed, given the
+	// arguments before it. It may be nil.
+	Complete func(args []string, word string) []string
+	// MinArgs and MaxArgs bound the number of arguments; MaxArgs < 0
+	// means no limit
+	MinArgs, MaxArgs int
+	// ArgPattern, if set, must match the first argument
+	ArgPattern *regexp.Regexp
+	// SlashOnly commands are only recognized with the slash prefix
+	SlashOnly bool
+	// RawArgs commands get the rest of the line as one argument, with
+	// quotes and spacing intact, and split it themselves
+	RawArgs bool
 }
 
 var (
-	shellCommands []ShellCommand
-	historyFile   string
+	shellCommands []*ShellCommand
+	// exitShell is set by the exit built-in to end the shell loop
+	exitShell bool
 )
 
 func init() {
-	home, _ := os.UserHomeDir()
-	historyFile = filepath.Join(home, ".neurocli_history")
-
-	shellCommands = []ShellCommand{
+	for _, cmd := range []ShellCommand{
 		{
 			Name:        "help",
-			Description: "Show this help message",
+			Aliases:     []string{"h", "?"},
+			Usage:       "[COMMAND]",
+			Description: "Show this help message, or the usage of one command",
 			Handler:     handleHelp,
+			MaxArgs:     1,
 		},
 		{
 			Name:        "exit",
+			Aliases:     []string{"quit", "q"},
 			Description: "Exit the shell",
 			Handler:     handleExit,
 		},
 		{
 			Name:        "clear",
+			Aliases:     []string{"cls"},
 			Description: "Clear the screen",
 			Handler:     handleClear,
 		},
 		{
 			Name:        "cd",
+			Usage:       "[DIR]",
 			Description: "Change directory",
 			Handler:     handleChangeDir,
+			Complete:    completeDirs,
+			MaxArgs:     1,
+		},
+		{
+			Name:        "export",
+			Usage:       "[NAME=VALUE...]",
+			Description: "Set environment variables for ! commands",
+			Handler:     handleExport,
+			MaxArgs:     -1,
+			ArgPattern:  regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`),
+			RawArgs:     true,
+		},
+		{
+			Name:        "unset",
+			Usage:       "NAME...",
+			Description: "Remove environment variables for ! commands",
+			Handler:     handleUnset,
+			MinArgs:     1,
+			MaxArgs:     -1,
+			ArgPattern:  regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`),
+		},
+		{
+			Name:        "alias",
+			Usage:       "[NAME=VALUE...]",
+			Description: "Define or list aliases for ! commands",
+			Handler:     handleAlias,
+			MaxArgs:     -1,
+			ArgPattern:  regexp.MustCompile(`^[\w.-]+=`),
+			RawArgs:     true,
+		},
+		{
+			Name:        "unalias",
+			Usage:       "NAME...",
+			Description: "Remove aliases",
+			Handler:     handleUnalias,
+			MinArgs:     1,
+			MaxArgs:     -1,
+		},
+		{
+			Name:        "jobs",
+			Description: "List background jobs started with !command &",
+			Handler:     handleJobs,
+		},
+		{
+			Name:        "fg",
+			Usage:       "[%N]",
+			Description: "Wait for a background job",
+			Handler:     handleForeground,
+			MaxArgs:     1,
+			ArgPattern:  regexp.MustCompile(`^%?\d+$`),
+		},
+		{
+			Name:        "kill",
+			Usage:       "[%N]",
+			Description: "Terminate a background job",
+			Handler:     handleKill,
+			MaxArgs:     1,
+			ArgPattern:  regexp.MustCompile(`^%?\d+$`),
+		},
+		{
+			Name:        "status",
+			Description: "Show the current provider, model and parameters",
+			Handler:     handleStatus,
+		},
+		{
+			Name:        "provider",
+			Usage:       "[NAME]",
+			Description: "Show or switch the AI provider",
+			Handler:     handleProvider,
+			Complete:    completeProviders,
+			MaxArgs:     1,
+			SlashOnly:   true,
+		},
+		{
+			Name:        "model",
+			Usage:       "[NAME]",
+			Description: "Show or switch the model",
+			Handler:     handleModel,
+			Complete:    completeModels,
+			MaxArgs:     1,
+			SlashOnly:   true,
+		},
+		{
+			Name:        "temp",
+			Aliases:     []string{"temperature"},
+			Usage:       "[0-2]",
+			Description: "Show or set the sampling temperature",
+			Handler:     handleTemperature,
+			MaxArgs:     1,
+			SlashOnly:   true,
+		},
+		{
+			Name:        "tokens",
+			Usage:       "[N]",
+			Description: "Show or set the maximum number of tokens per answer",
+			Handler:     handleTokens,
+			MaxArgs:     1,
+			SlashOnly:   true,
+		},
+		{
+			Name:        "persona",
+			Usage:       "[NAME]",
+			Description: "Show or switch the persona",
+			Handler:     handlePersona,
+			Complete:    completePersonas,
+			MaxArgs:     1,
+			SlashOnly:   true,
+		},
+		{
+			Name:        "history",
+			Usage:       "[-d] [-n N] [-s] [PATTERN]",
+			Description: "List or grep the history; -s picks an entry with fuzzy search, -d limits it to this directory",
+			Handler:     handleHistory,
+			MaxArgs:     -1,
+			ArgPattern:  regexp.MustCompile(`^-`),
+		},
+		{
+			Name:        "last",
+			Description: "Show the captured output of the last ! command (@last in a prompt)",
+			Handler:     handleLast,
+		},
+		{
+			Name:        "edit",
+			Description: "Compose the next prompt in $EDITOR",
+			Handler:     handleEditPrompt,
 		},
+		{
+			Name:        "copy",
+			Usage:       "N",
+			Description: "Copy code block N of the last answer to the clipboard",
+			Handler:     handleCopy,
+			Complete:    completeBlockNumbers,
+			MinArgs:     1,
+			MaxArgs:     1,
+			ArgPattern:  regexp.MustCompile(`^\d+$`),
+		},
+		{
+			Name:        "save",
+			Usage:       "N PATH",
+			Description: "Save code block N of the last answer to a file",
+			Handler:     handleSave,
+			Complete:    completeBlockNumbers,
+			MinArgs:     2,
+			MaxArgs:     2,
+			ArgPattern:  regexp.MustCompile(`^\d+$`),
+		},
+		{
+			Name:        "run",
+			Usage:       "N",
+			Description: "Run shell code block N of the last answer",
+			Handler:     handleRun,
+			Complete:    completeBlockNumbers,
+			MinArgs:     1,
+			MaxArgs:     1,
+			ArgPattern:  regexp.MustCompile(`^\d+$`),
+		},
+	} {
+		registerShellCommand(cmd)
 	}
 }
 
 // newShell creates a new liner instance with configuration
 func newShell() *liner.State {
-	line := liner.NewLiner()
+	line := newShellLiner()
 	line.SetTabCompletionStyle(liner.TabCircular)
 	line.SetCtrlCAborts(true)
 
-	// Set up command completion
-	var commands []string
-	for _, cmd := range shellCommands {
-		commands = append(commands, cmd.Name)
-	}
+	// Register neurocli-shell-* plugins found on PATH
+	registerShellPlugins()
 
-	line.SetCompleter(func(line string) (c []string) {
-		for _, cmd := range commands {
-			if strings.HasPrefix(cmd, strings.ToLower(line)) {
-				c = append(c, cmd)
-			}
-		}
-		return
-	})
+	// Complete built-ins, paths, executables, git refs and earlier prompts
+	line.SetWordCompleter(completeShellLine)
 
 	// Load history
-	if f, err := os.Open(historyFile); err == nil {
-		line.ReadHistory(f)
-		f.Close()
+	history, err := loadHistory()
+	if err != nil {
+		pterm.Warning.Println(err)
 	}
+	if history != nil {
+		promptHistory = history
+	}
+	promptHistory.fill(line)
 
 	return line
 }
 
-// saveHistory saves the command history to a file
-func saveHistory(line *liner.State) {
-	if f, err := os.Create(historyFile); err == nil {
-		line.WriteHistory(f)
-		f.Close()
+func handleShell() error {
+	// Input from a file or pipe runs as a script
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return runScript(os.Stdin, "stdin", scriptOptions{})
 	}
-}
-
-// getPrompt returns a simple, reliable prompt string
-func getPrompt() string {
-	return "> "
-}
 
-func handleShell() error {
 	line := newShell()
 	defer line.Close()
 
 	// Save history on exit
-	defer saveHistory(line)
-
-	// Save limited history on exit
 	defer func() {
-		if f, err := os.Create(historyFile); err == nil {
-			defer f.Close()
-			// WriteHistory will write the current history to the writer
-			line.WriteHistory(f)
+		if err := promptHistory.save(); err != nil {
+			pterm.Warning.Printf("Failed to save history: %v\n", err)
 		}
 	}()
 
 	fmt.Println("NeuroCLI Shell - Type 'help' for commands, 'exit' to quit")
 
-	for {
-		input, err := line.Prompt(getPrompt())
-		if err != nil {
-			if err == liner.ErrPromptAborted {
-				fmt.Println("^C")
-				continue
+	exitShell = false
+	historyDir := currentDir()
+	for !exitShell {
+		shellVars.reportJobs()
+
+		// Per-directory history follows the working directory
+		if dir := currentDir(); dir != historyDir {
+			historyDir = dir
+			if viper.GetBool("history.per_directory") {
+				promptHistory.fill(line)
+			}
+		}
+
+		// Input composed in the editor is always sent to the AI
+		input, composed := pendingInput, pendingInput != ""
+		pendingInput = ""
+		if !composed {
+			var err error
+			input, err = readInput(line)
+			if err != nil {
+				if err == liner.ErrPromptAborted {
+					fmt.Println("^C")
+					continue
+				}
+				if err == io.EOF {
+					fmt.Println()
+					return nil
+				}
+				return err
 			}
-			return err
 		}
 
+		// A leading space keeps the input out of the history
+		if promptHistory.add(input, historyDir) {
+			promptHistory.fill(line)
+		}
 		input = strings.TrimSpace(input)
 		if input == "" {
 			continue
 		}
 
-		line.AppendHistory(input)
-
-		parts := strings.Fields(input)
-		if len(parts) == 0 {
-			continue
+		if err := processLine(input, composed); err != nil {
+			pterm.Error.Println(err)
 		}
+	}
+	return nil
+}
 
-		cmd := strings.ToLower(parts[0])
-		args := parts[1:]
-
-		// Handle built-in commands
-		if handleBuiltInCommand(cmd, args) {
-			continue
+// processLine runs one input: a built-in, a ! command or a prompt for the
+// AI. Input composed in the editor and multiline input are always prompts.
+func processLine(input string, composed bool) error {
+	if composed {
+		return askAndPrint(input)
+	}
+	if !strings.Contains(input, "\n") {
+		if ok, err := handleBuiltInCommand(input); ok {
+			return err
 		}
+	}
+	if strings.HasPrefix(input, "!") {
+		return handleShellCommand(strings.TrimSpace(input[1:]))
+	}
+	return askAndPrint(input)
+}
 
-		// Handle shell commands (prefixed with '!')
-		if handleShellCommand(input) {
-			continue
-		}
+// askAndPrint sends a prompt to the AI and prints the answer, running it
+// instead if the AI answers with a command. @last in the prompt is replaced
+// by the output of the previous ! command.
+func askAndPrint(prompt string) error {
+	prompt, err := withLastRun(prompt)
+	if err != nil {
+		return err
+	}
 
-		// Handle as AI query
-		response, err := askAI(input)
-		if err != nil {
-			pterm.Error.Println("Error:", err)
-			continue
-		}
+	response, err := askAI(prompt)
+	if err != nil {
+		return err
+	}
+	writeTranscript("%s\n\n", strings.TrimSpace(response))
 
-		// If AI response is a command to execute
-		if strings.HasPrefix(response, "Command: ") {
-			cmdStr := strings.TrimSpace(strings.TrimPrefix(response, "Command: "))
-			if !isValidCommand(cmdStr) {
-				pterm.Error.Println("Invalid or potentially unsafe command.")
-				continue
-			}
-			pterm.Info.Println("Executing command:", cmdStr)
-			if err := executeCommand(cmdStr); err != nil {
-				pterm.Error.Println("Command failed:", err)
-			}
-			continue
+	// If AI response is a command to execute
+	if strings.HasPrefix(response, "Command: ") {
+		cmdStr := strings.TrimSpace(strings.TrimPrefix(response, "Command: "))
+		if !isValidCommand(cmdStr) {
+			return fmt.Errorf("invalid or potentially unsafe command: %s", cmdStr)
 		}
-
-		// Print AI response with code block formatting if present
-		if strings.Contains(response, "```") {
-			parts := strings.Split(response, "```")
-			for i, part := range parts {
-				if i%2 == 1 { // Code block
-					fmt.Println("\n--- CODE ---")
-					fmt.Println(part)
-					fmt.Println("------------")
-					fmt.Println()
-				} else {
-					fmt.Print(part)
-				}
-			}
-		} else {
-			fmt.Println(response)
+		if skipDryRun("run " + cmdStr) {
+			return nil
+		}
+		pterm.Info.Println("Executing command:", cmdStr)
+		if err := executeCaptured(cmdStr, cmdStr); err != nil {
+			return fmt.Errorf("command failed: %v", err)
 		}
+		return nil
 	}
+
+	// Print AI response with numbered code blocks for copy/save/run
+	lastCodeBlocks = extractCodeBlocks(response)
+	fmt.Println(renderMarkdown(response, true))
+	return nil
 }
 
-// handleBuiltInCommand encapsulates handling of built-in shell commands.
-func handleBuiltInCommand(cmd string, args []string) bool {
-	for _, shellCmd := range shellCommands {
-		if shellCmd.Name == cmd {
-			if err := shellCmd.Handler(args); err != nil {
-				pterm.Error.Println(err)
-			}
-			return true
-		}
+// handleShellCommand runs a ! command, given without the !. Commands that
+// change the shell's state are handled here, a trailing & starts a
+// background job, and everything else goes through the execution gate.
+func handleShellCommand(cmdStr string) error {
+	if ok, err := shellVars.handleStateCommand(cmdStr); ok {
+		return err
 	}
-	return false
-}
 
-// handleShellCommand encapsulates handling of shell commands (prefixed with '!').
-func handleShellCommand(input string) bool {
-	if strings.HasPrefix(input, "!") {
-		cmdStr := strings.TrimSpace(input[1:])
-		if !isValidCommand(cmdStr) {
-			pterm.Error.Println("Invalid or potentially unsafe command.")
-			return true
-		}
-		if err := executeCommand(cmdStr); err != nil {
-			pterm.Error.Println("Command failed:", err)
-		}
-		return true
+	cmdStr, question, piped := splitPipeToAI(cmdStr)
+	command := shellVars.expandAlias(cmdStr)
+	background := !piped && strings.HasSuffix(command, "&") && !strings.HasSuffix(command, "&&")
+	if background {
+		command = strings.TrimSpace(strings.TrimSuffix(command, "&"))
 	}
-	return false
+
+	ok, err := gateScript(command)
+	if err != nil || !ok {
+		return err
+	}
+
+	if background {
+		return shellVars.startJob(cmdStr, shellVars.withFunctions(command))
+	}
+	err = executeCaptured(cmdStr, shellVars.withFunctions(command))
+
+	// Hand the output to the AI; a failing command is usually why
+	if piped {
+		return askAndPrint(question + "\n\n" + lastRun.context())
+	}
+	if err != nil {
+		return fmt.Errorf("command failed: %v", err)
+	}
+	return nil
 }
 
 // isValidCommand checks if a command is safe to execute
@@ -243,6 +439,23 @@ func isValidCommand(cmd string) bool {
 		return false
 	}
 
+	// Chains, pipes, redirections and substitutions can run or overwrite
+	// anything, whatever the first word is
+	for _, meta := range shellMetachars {
+		if strings.Contains(cmd, meta) {
+			return false
+		}
+	}
+
+	// find can delete files, run commands and write files itself
+	if parts[0] == "find" {
+		for _, part := range parts[1:] {
+			if unsafeFindActions[part] {
+				return false
+			}
+		}
+	}
+
 	// Check if the command is in the allowed list
 	for _, allowed := range allowedCommands {
 		if parts[0] == allowed {
@@ -253,15 +466,32 @@ func isValidCommand(cmd string) bool {
 	return false
 }
 
+// shellMetachars turn a line into more than one simple command
+var shellMetachars = []string{";", "&", "|", "<", ">", "`", "$(", "${", "\n"}
+
+// unsafeFindActions are the find expressions that change anything
+var unsafeFindActions = map[string]bool{
+	"-delete": true, "-exec": true, "-execdir": true, "-ok": true, "-okdir": true,
+	"-fprint": true, "-fprint0": true, "-fprintf": true, "-fls": true,
+}
+
 // Command handlers
 func handleHelp(args []string) error {
-	t := table.New().
-		Border(lipgloss.NormalBorder()).
-		BorderStyle(lipgloss.NewStyle().Foreground(lipgloss.Color("63"))).
-		Headers("COMMAND", "DESCRIPTION")
+	if len(args) == 1 {
+		cmd, ok := lookupShellCommand(strings.TrimPrefix(args[0], "/"))
+		if !ok {
+			return fmt.Errorf("unknown command %s", args[0])
+		}
+		fmt.Printf("Usage: %s\n\n%s\n", cmd.usage(), cmd.Description)
+		if len(cmd.Aliases) > 0 {
+			fmt.Printf("\nAliases: /%s\n", strings.Join(cmd.Aliases, ", /"))
+		}
+		return nil
+	}
 
+	t := newShellTable("COMMAND", "DESCRIPTION")
 	for _, cmd := range shellCommands {
-		t.Row(cmd.Name, cmd.Description)
+		t.Row(cmd.usage(), cmd.Description)
 	}
 
 	// Add AI commands
@@ -272,9 +502,17 @@ func handleHelp(args []string) error {
 	return nil
 }
 
+// newShellTable returns the table style used by shell built-ins
+func newShellTable(headers ...string) *table.Table {
+	return table.New().
+		Border(lipgloss.NormalBorder()).
+		BorderStyle(lipgloss.NewStyle().Foreground(lipgloss.Color("63"))).
+		Headers(headers...)
+}
+
 func handleExit(args []string) error {
 	pterm.Info.Println("Goodbye!")
-	os.Exit(0)
+	exitShell = true
 	return nil
 }
 
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aymanbagabas/go-osc52/v2"
+	"github.com/pterm/pterm"
+)
+
+// lastCodeBlocks holds the code blocks of the most recent AI response in
+// the shell, numbered from 1 as printed
+var lastCodeBlocks []codeBlock
+
+// codeBlockArg resolves the block number in args[0]
+func codeBlockArg(args []string) (codeBlock, error) {
+	if len(lastCodeBlocks) == 0 {
+		return codeBlock{}, fmt.Errorf("the last response has no code blocks")
+	}
+	if len(args) == 0 {
+		return codeBlock{}, fmt.Errorf("missing code block number (1-%d)", len(lastCodeBlocks))
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 || n > len(lastCodeBlocks) {
+		return codeBlock{}, fmt.Errorf("invalid code block %q, expected 1-%d", args[0], len(lastCodeBlocks))
+	}
+	return lastCodeBlocks[n-1], nil
+}
+
+// handleCopy copies a code block to the clipboard with an OSC52 escape
+// sequence, which works over SSH and inside tmux or screen
+func handleCopy(args []string) error {
+	block, err := codeBlockArg(args)
+	if err != nil {
+		return err
+	}
+
+	seq := osc52.New(block.Code)
+	switch {
+	case os.Getenv("TMUX") != "":
+		seq = seq.Tmux()
+	case strings.HasPrefix(os.Getenv("TERM"), "screen"):
+		seq = seq.Screen()
+	}
+	if _, err := seq.WriteTo(os.Stderr); err != nil {
+		return fmt.Errorf("failed to copy to clipboard: %v", err)
+	}
+	pterm.Success.Printf("✓ Copied code block %s to the clipboard\n", args[0])
+	return nil
+}
+
+// handleSave writes a code block to a file, recording it in the undo journal
+func handleSave(args []string) error {
+	block, err := codeBlockArg(args)
+	if err != nil {
+		return err
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("usage: save N PATH")
+	}
+	path := args[1]
+	if skipDryRun("save code block " + args[0] + " to " + path) {
+		return nil
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		ok, err := confirm(fmt.Sprintf("%s already exists. Overwrite?", path))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+	}
+
+	content := block.Code
+	if !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	if err := writeWithJournal("save: "+path, map[string]string{path: content}); err != nil {
+		return err
+	}
+	pterm.Success.Printf("✓ Saved code block %s to %s\n", args[0], pterm.Green(path))
+	return nil
+}
+
+// handleRun executes a shell code block through the execution gate
+func handleRun(args []string) error {
+	block, err := codeBlockArg(args)
+	if err != nil {
+		return err
+	}
+	if block.Lang != "" {
+		if lang, ok := lookupLanguage(block.Lang); !ok || lang.Name != "Shell" {
+			return fmt.Errorf("code block %s is %s, only shell snippets can be run", args[0], block.Lang)
+		}
+	}
+	return executeGated(block.Code)
+}
+
+// executeGated runs a command or script through the execution gate
+func executeGated(script string) error {
+	ok, err := gateScript(script)
+	if err != nil || !ok {
+		return err
+	}
+	return executeCaptured(script, shellVars.withFunctions(script))
+}
+
+// gateScript is the execution gate. It decides whether a script may run:
+// scripts made only of allowlisted commands run directly; anything else is
+// shown and needs confirmation. The script itself is run as written.
+func gateScript(script string) (bool, error) {
+	commands := scriptCommands(script)
+	if len(commands) == 0 {
+		return false, fmt.Errorf("nothing to run")
+	}
+	if skipDryRun("run " + strings.Join(commands, "; ")) {
+		return false, nil
+	}
+
+	if scriptAllowlisted(script) {
+		return true, nil
+	}
+	pterm.Warning.Println("This will run:")
+	for _, line := range strings.Split(strings.TrimRight(script, "\n"), "\n") {
+		fmt.Println("  " + pterm.Cyan(line))
+	}
+	return confirm("Run it?")
+}
+
+// scriptAllowlisted reports whether the gate runs a script without asking
+func scriptAllowlisted(script string) bool {
+	for _, c := range scriptCommands(script) {
+		if !isValidCommand(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// scriptCommands returns the commands of a script for the allowlist check,
+// with continued lines joined and comments and "$ " prompts dropped
+func scriptCommands(script string) []string {
+	// Join lines continued with a backslash, as the system shell would
+	script = strings.ReplaceAll(script, "\\\n", " ")
+
+	var commands []string
+	for _, line := range strings.Split(script, "\n") {
+		line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "$ "))
+		if line != "" && !strings.HasPrefix(line, "#") {
+			commands = append(commands, line)
+		}
+	}
+	return commands
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScriptCommands(t *testing.T) {
+	tests := []struct {
+		script string
+		want   []string
+	}{
+		{"ls -la", []string{"ls -la"}},
+		{"$ ls\n$ pwd\n", []string{"ls", "pwd"}},
+		{"# list files\nls\n\n  # done\n", []string{"ls"}},
+		{"grep -r \\\n  foo .", []string{"grep -r    foo ."}},
+		{"\n\n# only a comment\n", nil},
+	}
+	for _, tt := range tests {
+		if got := scriptCommands(tt.script); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("scriptCommands(%q) = %q, want %q", tt.script, got, tt.want)
+		}
+	}
+}
+
+func TestIsValidCommand(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		want bool
+	}{
+		{"ls -la", true},
+		{"echo hello", true},
+		{"find . -name '*.go'", true},
+		{"", false},
+		{"rm -rf /", false},
+		{"ls; rm -rf /", false},
+		{"ls && rm -rf /", false},
+		{"cat file | sh", false},
+		{"echo hi > notes.txt", false},
+		{"echo $(rm -rf /)", false},
+		{"echo `id`", false},
+		{"cat <<EOF", false},
+		{"find . -delete", false},
+		{"find . -exec rm {} +", false},
+		{"find . -fprint out.txt", false},
+	}
+	for _, tt := range tests {
+		if got := isValidCommand(tt.cmd); got != tt.want {
+			t.Errorf("isValidCommand(%q) = %v, want %v", tt.cmd, got, tt.want)
+		}
+	}
+}
+
+func TestGateScriptAllowlisted(t *testing.T) {
+	ok, err := gateScript("$ ls -la\n# where am I\npwd\n")
+	if err != nil || !ok {
+		t.Errorf("allowlisted script: ok %v, err %v", ok, err)
+	}
+	if _, err := gateScript("# nothing\n\n"); err == nil {
+		t.Error("empty script: no error")
+	}
+
+	dryRun = true
+	defer func() { dryRun = false }()
+	if ok, err := gateScript("ls"); err != nil || ok {
+		t.Errorf("dry run: ok %v, err %v", ok, err)
+	}
+}
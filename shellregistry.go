@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// shellPluginPrefix is the name prefix of executables on PATH that are
+// registered as shell built-ins, e.g. neurocli-shell-deploy becomes /deploy
+const shellPluginPrefix = "neurocli-shell-"
+
+// shellCommandIndex maps built-in names and aliases to their command
+var shellCommandIndex = make(map[string]*ShellCommand)
+
+// registerShellCommand adds a built-in to the registry. Names and aliases
+// already taken are left with their first owner, so built-ins win over
+// plugins.
+func registerShellCommand(cmd ShellCommand) {
+	c := &cmd
+	if _, taken := shellCommandIndex[c.Name]; taken {
+		return
+	}
+	shellCommands = append(shellCommands, c)
+	for _, name := range append([]string{c.Name}, c.Aliases...) {
+		if _, taken := shellCommandIndex[name]; !taken {
+			shellCommandIndex[name] = c
+		}
+	}
+
+	// help takes a command name, so "help me with ..." stays a prompt
+	if help, ok := shellCommandIndex["help"]; ok {
+		names := make([]string, 0, len(shellCommandIndex))
+		for name := range shellCommandIndex {
+			names = append(names, regexp.QuoteMeta(name))
+		}
+		help.ArgPattern = regexp.MustCompile(`^/?(` + strings.Join(names, "|") + `)$`)
+	}
+}
+
+// lookupShellCommand finds a built-in by name or alias
+func lookupShellCommand(name string) (*ShellCommand, bool) {
+	cmd, ok := shellCommandIndex[strings.ToLower(name)]
+	return cmd, ok
+}
+
+// acceptsArgs reports whether args fit the command's argument spec
+func (c *ShellCommand) acceptsArgs(args []string) bool {
+	if len(args) < c.MinArgs || c.MaxArgs >= 0 && len(args) > c.MaxArgs {
+		return false
+	}
+	return c.ArgPattern == nil || len(args) == 0 || c.ArgPattern.MatchString(args[0])
+}
+
+// handlerArgs returns the arguments the handler gets for the text after the
+// command name
+func (c *ShellCommand) handlerArgs(rest string) []string {
+	rest = strings.TrimSpace(rest)
+	if c.RawArgs && rest != "" {
+		return []string{rest}
+	}
+	return strings.Fields(rest)
+}
+
+// usage returns the command's usage line, e.g. "/save N PATH"
+func (c *ShellCommand) usage() string {
+	return strings.TrimSpace("/" + c.Name + " " + c.Usage)
+}
+
+// handleBuiltInCommand runs input as a built-in if it is one, reporting
+// whether it was and the command's error. With a slash prefix the input is
+// always a built-in; a bare name only counts when its arguments fit the
+// command, so prompts like "run the tests for me" still go to the AI.
+func handleBuiltInCommand(input string) (bool, error) {
+	parts := strings.Fields(input)
+	if len(parts) == 0 {
+		return false, nil
+	}
+	name, slash := strings.CutPrefix(parts[0], "/")
+	args := parts[1:]
+	_, rest, _ := strings.Cut(strings.TrimSpace(input), parts[0])
+
+	cmd, ok := lookupShellCommand(name)
+	switch {
+	case !ok && slash:
+		return true, fmt.Errorf("unknown command /%s, see /help", name)
+	case !ok:
+		return false, nil
+	case !slash && (cmd.SlashOnly || !cmd.acceptsArgs(args)):
+		return false, nil
+	case !cmd.acceptsArgs(args):
+		return true, fmt.Errorf("usage: %s", cmd.usage())
+	}
+	return true, cmd.Handler(cmd.handlerArgs(rest))
+}
+
+// registerShellPlugins registers every neurocli-shell-* executable on PATH
+// as a slash command
+func registerShellPlugins() {
+	for _, exe := range pathExecutables() {
+		name, ok := strings.CutPrefix(exe, shellPluginPrefix)
+		if !ok || name == "" {
+			continue
+		}
+		registerShellCommand(ShellCommand{
+			Name:        name,
+			Description: fmt.Sprintf("External command (%s)", exe),
+			Usage:       "[ARGS...]",
+			Handler:     pluginHandler(exe),
+			Complete:    func(args []string, word string) []string { return completePaths(word, false) },
+			MaxArgs:     -1,
+			SlashOnly:   true,
+		})
+	}
+}
+
+// pluginHandler runs a plugin executable with the shell's environment. The
+// plugin learns about the session through NEUROCLI_* variables.
+func pluginHandler(exe string) func([]string) error {
+	return func(args []string) error {
+		if skipDryRun(strings.Join(append([]string{exe}, args...), " ")) {
+			return nil
+		}
+		cmd := exec.Command(exe, args...)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		cmd.Env = append(shellVars.environ(),
+			"NEUROCLI_PROVIDER="+viper.GetString("provider"),
+			"NEUROCLI_MODEL="+viper.GetString("model"),
+			"NEUROCLI_PERSONA="+viper.GetString("persona"),
+		)
+		if lastRun != nil {
+			cmd.Env = append(cmd.Env, fmt.Sprintf("NEUROCLI_LAST_EXIT_STATUS=%d", lastRun.ExitCode))
+		}
+		return recordExitStatus(runCommand(cmd))
+	}
+}
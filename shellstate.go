@@ -0,0 +1,483 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pterm/pterm"
+)
+
+// shellState is what the interactive shell remembers between ! commands,
+// each of which runs in a fresh system shell
+type shellState struct {
+	env       map[string]string
+	unset     map[string]bool
+	aliases   map[string]string
+	functions map[string]string
+	jobs      []*shellJob
+	nextJob   int
+}
+
+// shellJob is a command running in the background
+type shellJob struct {
+	ID      int
+	Command string
+	cmd     *exec.Cmd
+	done    chan struct{}
+	err     error
+}
+
+var shellVars = &shellState{
+	env:       make(map[string]string),
+	unset:     make(map[string]bool),
+	aliases:   make(map[string]string),
+	functions: make(map[string]string),
+	nextJob:   1,
+}
+
+// functionPattern matches a shell function definition such as
+// "greet() { echo hi; }" or "function greet { ... }"
+var functionPattern = regexp.MustCompile(`^(?:function\s+([A-Za-z_][\w-]*)\s*(?:\(\s*\))?|([A-Za-z_][\w-]*)\s*\(\s*\))\s*\{[\s\S]*\}$`)
+
+// environ returns the process environment with exported and unset
+// variables applied
+func (s *shellState) environ() []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if _, exported := s.env[name]; !exported && !s.unset[name] {
+			env = append(env, kv)
+		}
+	}
+	for name, value := range s.env {
+		env = append(env, name+"="+value)
+	}
+	return env
+}
+
+// lookupEnv finds a variable as commands started from the shell see it
+func (s *shellState) lookupEnv(name string) string {
+	if value, ok := s.env[name]; ok {
+		return value
+	}
+	if s.unset[name] {
+		return ""
+	}
+	return os.Getenv(name)
+}
+
+// expandAlias replaces an alias in the first word of a command
+func (s *shellState) expandAlias(command string) string {
+	name, rest, _ := strings.Cut(command, " ")
+	if expansion, ok := s.aliases[name]; ok {
+		return strings.TrimSpace(expansion + " " + rest)
+	}
+	return command
+}
+
+// withFunctions prepends the defined functions to a command so the system
+// shell knows them
+func (s *shellState) withFunctions(command string) string {
+	if len(s.functions) == 0 || runtime.GOOS == "windows" {
+		return command
+	}
+
+	names := make([]string, 0, len(s.functions))
+	for name := range s.functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(s.functions[name] + "\n")
+	}
+	return b.String() + command
+}
+
+// handleStateCommand handles ! commands that only change shell state, which
+// would be lost if they ran in a child shell. It reports whether it did.
+func (s *shellState) handleStateCommand(command string) (bool, error) {
+	if m := functionPattern.FindStringSubmatch(command); m != nil {
+		name := m[1] + m[2]
+		s.functions[name] = command
+		pterm.Info.Printf("Defined function %s\n", name)
+		return true, nil
+	}
+
+	head, op, next := splitAtOperator(command)
+	name, rest, _ := strings.Cut(head, " ")
+	switch name {
+	case "export", "unset", "alias", "unalias", "cd":
+	default:
+		return false, nil
+	}
+	builtin, _ := lookupShellCommand(name)
+	args := builtin.handlerArgs(rest)
+
+	// The state change happens here and the rest of the line runs in the
+	// child shell afterwards, as the system shell would sequence it
+	switch op {
+	case "":
+		return true, builtin.Handler(args)
+	case "&&", "||", ";":
+	default:
+		return true, fmt.Errorf("%s can't be combined with %s here; run the commands separately", name, op)
+	}
+	err := builtin.Handler(args)
+	if strings.TrimSpace(next) == "" {
+		return true, err
+	}
+	switch {
+	case op == "&&" && err != nil:
+		return true, err
+	case op == "||" && err == nil:
+		return true, nil
+	case err != nil:
+		pterm.Error.Println(err)
+	}
+	return true, handleShellCommand(strings.TrimSpace(next))
+}
+
+// splitAtOperator splits a command line at its first control operator or
+// redirection outside quotes
+func splitAtOperator(command string) (head, op, rest string) {
+	var quote byte
+	escaped := false
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		default:
+			if op := matchOperator(command[i:]); op != "" && !strings.HasPrefix(op, "2") {
+				return strings.TrimSpace(command[:i]), op, command[i+len(op):]
+			}
+		}
+	}
+	return command, "", ""
+}
+
+// shellWord is a word of a command line, kept in parts so text that was
+// single-quoted or escaped can be told apart from text that is expanded
+type shellWord []wordPart
+
+// wordPart is a run of a word's text; literal text takes no $ expansion
+type wordPart struct {
+	text    string
+	literal bool
+}
+
+// String returns the word's text with quotes and escapes removed
+func (w shellWord) String() string {
+	var b strings.Builder
+	for _, p := range w {
+		b.WriteString(p.text)
+	}
+	return b.String()
+}
+
+// expand expands $NAME and ${NAME} outside the word's literal parts
+func (w shellWord) expand(mapping func(string) string) string {
+	var b strings.Builder
+	for _, p := range w {
+		if p.literal {
+			b.WriteString(p.text)
+		} else {
+			b.WriteString(os.Expand(p.text, mapping))
+		}
+	}
+	return b.String()
+}
+
+// cut splits the word around the first sep outside literal text, as
+// strings.Cut does
+func (w shellWord) cut(sep string) (string, shellWord, bool) {
+	var before strings.Builder
+	for i, p := range w {
+		if !p.literal {
+			if head, tail, ok := strings.Cut(p.text, sep); ok {
+				before.WriteString(head)
+				after := append(shellWord{{tail, false}}, w[i+1:]...)
+				return before.String(), after, true
+			}
+		}
+		before.WriteString(p.text)
+	}
+	return before.String(), nil, false
+}
+
+// splitShellWords splits text into words, honoring single and double quotes
+// and backslash escapes
+func splitShellWords(text string) ([]shellWord, error) {
+	var words []shellWord
+	var word shellWord
+	var part strings.Builder
+	literal, inWord := false, false
+	var quote rune
+	escaped := false
+
+	// add appends r to the word, starting a new part when the text switches
+	// between literal and expanded
+	add := func(r rune, lit bool) {
+		if lit != literal && part.Len() > 0 {
+			word = append(word, wordPart{part.String(), literal})
+			part.Reset()
+		}
+		literal, inWord = lit, true
+		part.WriteRune(r)
+	}
+	endWord := func() {
+		if part.Len() > 0 {
+			word = append(word, wordPart{part.String(), literal})
+			part.Reset()
+		}
+		if inWord {
+			words = append(words, word)
+		}
+		word, inWord = nil, false
+	}
+
+	for _, r := range text {
+		switch {
+		case escaped:
+			add(r, true)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				add(r, quote == '\'')
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t':
+			endWord()
+		default:
+			add(r, false)
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	endWord()
+	return words, nil
+}
+
+// handleExport sets variables for later ! commands, or lists them. It gets
+// the rest of the line unsplit, so quoted values keep their spacing.
+func handleExport(args []string) error {
+	s := shellVars
+	if len(args) == 0 {
+		names := make([]string, 0, len(s.env))
+		for name := range s.env {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("export %s=%q\n", name, s.env[name])
+		}
+		return nil
+	}
+
+	words, err := splitShellWords(strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+	for _, w := range words {
+		name, value, ok := w.cut("=")
+		if ok {
+			s.env[name] = value.expand(s.lookupEnv)
+		} else {
+			s.env[name] = s.lookupEnv(name)
+		}
+		delete(s.unset, name)
+	}
+	return nil
+}
+
+// handleUnset removes variables from the environment of later ! commands
+func handleUnset(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: unset NAME...")
+	}
+	for _, name := range args {
+		delete(shellVars.env, name)
+		shellVars.unset[name] = true
+	}
+	return nil
+}
+
+// handleAlias defines aliases for ! commands, or lists them. Like export it
+// gets the rest of the line unsplit.
+func handleAlias(args []string) error {
+	s := shellVars
+	if len(args) == 0 {
+		names := make([]string, 0, len(s.aliases))
+		for name := range s.aliases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("alias %s='%s'\n", name, s.aliases[name])
+		}
+		return nil
+	}
+
+	words, err := splitShellWords(strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+	for _, w := range words {
+		name, value, ok := strings.Cut(w.String(), "=")
+		if !ok {
+			expansion, found := s.aliases[name]
+			if !found {
+				return fmt.Errorf("alias %s not found", name)
+			}
+			fmt.Printf("alias %s='%s'\n", name, expansion)
+			continue
+		}
+		s.aliases[name] = value
+	}
+	return nil
+}
+
+// handleUnalias removes aliases
+func handleUnalias(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: unalias NAME...")
+	}
+	for _, name := range args {
+		if _, ok := shellVars.aliases[name]; !ok {
+			return fmt.Errorf("alias %s not found", name)
+		}
+		delete(shellVars.aliases, name)
+	}
+	return nil
+}
+
+// startJob runs a prepared command in the background in its own process
+// group, so Ctrl-C at the prompt doesn't reach it
+func (s *shellState) startJob(display, command string) error {
+	cmd := shellCommand(command)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	detachProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	job := &shellJob{ID: s.nextJob, Command: display, cmd: cmd, done: make(chan struct{})}
+	s.nextJob++
+	s.jobs = append(s.jobs, job)
+	go func() {
+		job.err = cmd.Wait()
+		close(job.done)
+	}()
+	fmt.Printf("[%d] %d\n", job.ID, cmd.Process.Pid)
+	return nil
+}
+
+// reportJobs prints and forgets background jobs that have finished. The
+// shell calls it before each prompt.
+func (s *shellState) reportJobs() {
+	running := s.jobs[:0]
+	for _, job := range s.jobs {
+		select {
+		case <-job.done:
+			status := "Done"
+			switch code := exitCode(job.err); {
+			case code < 0:
+				status = "Killed"
+			case code > 0:
+				status = fmt.Sprintf("Exit %d", code)
+			}
+			fmt.Printf("[%d] %-8s %s\n", job.ID, status, job.Command)
+		default:
+			running = append(running, job)
+		}
+	}
+	s.jobs = running
+}
+
+// findJob resolves a job spec such as %2 or 2; an empty spec is the newest job
+func (s *shellState) findJob(args []string) (*shellJob, error) {
+	if len(s.jobs) == 0 {
+		return nil, fmt.Errorf("no background jobs")
+	}
+	if len(args) == 0 {
+		return s.jobs[len(s.jobs)-1], nil
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(args[0], "%"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid job %q", args[0])
+	}
+	for _, job := range s.jobs {
+		if job.ID == id {
+			return job, nil
+		}
+	}
+	return nil, fmt.Errorf("no such job: %s", args[0])
+}
+
+// handleJobs lists the background jobs
+func handleJobs(args []string) error {
+	shellVars.reportJobs()
+	for _, job := range shellVars.jobs {
+		fmt.Printf("[%d] %-8s %s\n", job.ID, "Running", job.Command)
+	}
+	return nil
+}
+
+// handleForeground waits for a background job, passing Ctrl-C on to it
+func handleForeground(args []string) error {
+	job, err := shellVars.findJob(args)
+	if err != nil {
+		return err
+	}
+	fmt.Println(job.Command)
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	for waiting := true; waiting; {
+		select {
+		case <-interrupts:
+			interruptProcessGroup(job.cmd.Process)
+		case <-job.done:
+			waiting = false
+		}
+	}
+
+	shellVars.reportJobs()
+	return recordExitStatus(job.err)
+}
+
+// handleKill terminates a background job
+func handleKill(args []string) error {
+	job, err := shellVars.findJob(args)
+	if err != nil {
+		return err
+	}
+	if err := terminateProcessGroup(job.cmd.Process); err != nil {
+		return fmt.Errorf("failed to kill job %d: %v", job.ID, err)
+	}
+	return nil
+}
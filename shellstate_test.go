@@ -0,0 +1,105 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitShellWords(t *testing.T) {
+	tests := []struct {
+		text  string
+		words []string
+	}{
+		{"a b  c", []string{"a", "b", "c"}},
+		{`A="x   y" B=z`, []string{"A=x   y", "B=z"}},
+		{`'it''s' ""`, []string{"its", ""}},
+		{`a\ b "c\"d"`, []string{"a b", `c"d`}},
+		{`'a\b'`, []string{`a\b`}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		words, err := splitShellWords(tt.text)
+		if err != nil {
+			t.Errorf("%s: %v", tt.text, err)
+			continue
+		}
+		var got []string
+		for _, w := range words {
+			got = append(got, w.String())
+		}
+		if !reflect.DeepEqual(got, tt.words) {
+			t.Errorf("splitShellWords(%q) = %q, want %q", tt.text, got, tt.words)
+		}
+	}
+
+	if _, err := splitShellWords(`echo "open`); err == nil {
+		t.Error("unterminated quote: no error")
+	}
+}
+
+func TestShellWordExpand(t *testing.T) {
+	env := map[string]string{"HOME": "/home/me", "USER": "me"}
+	mapping := func(name string) string { return env[name] }
+	tests := []struct {
+		text, want string
+	}{
+		{`$HOME/bin`, "/home/me/bin"},
+		{`"$HOME dir"`, "/home/me dir"},
+		{`'$HOME'`, "$HOME"},
+		{`\$HOME`, "$HOME"},
+		{`'$USER'@"$USER"`, "$USER@me"},
+		{`${USER}x`, "mex"},
+	}
+	for _, tt := range tests {
+		words, err := splitShellWords(tt.text)
+		if err != nil || len(words) != 1 {
+			t.Errorf("%s: %v, %d words", tt.text, err, len(words))
+			continue
+		}
+		if got := words[0].expand(mapping); got != tt.want {
+			t.Errorf("expand(%s) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestExportBuiltIn(t *testing.T) {
+	defer func() {
+		shellVars.env = make(map[string]string)
+		shellVars.unset = make(map[string]bool)
+	}()
+	t.Setenv("NEUROCLI_TEST_HOME", "/home/me")
+
+	tests := []struct {
+		line, name, want string
+	}{
+		{`export A="x   y"`, "A", "x   y"},
+		{`export B='$NEUROCLI_TEST_HOME'`, "B", "$NEUROCLI_TEST_HOME"},
+		{`export C=$NEUROCLI_TEST_HOME/bin`, "C", "/home/me/bin"},
+		{`/export lower_case="a b"`, "lower_case", "a b"},
+	}
+	for _, tt := range tests {
+		ok, err := handleBuiltInCommand(tt.line)
+		if !ok || err != nil {
+			t.Errorf("%s: handled %v, err %v", tt.line, ok, err)
+			continue
+		}
+		if got := shellVars.env[tt.name]; got != tt.want {
+			t.Errorf("%s: %s=%q, want %q", tt.line, tt.name, got, tt.want)
+		}
+	}
+
+	// ! commands reach the same built-in through handleStateCommand
+	if ok, err := shellVars.handleStateCommand(`export D="p  q"`); !ok || err != nil {
+		t.Fatalf("handleStateCommand: handled %v, err %v", ok, err)
+	}
+	if got := shellVars.env["D"]; got != "p  q" {
+		t.Errorf("D=%q, want %q", got, "p  q")
+	}
+
+	if ok, err := handleBuiltInCommand("unset lower_case"); !ok || err != nil {
+		t.Fatalf("unset lower_case: handled %v, err %v", ok, err)
+	}
+	if _, set := shellVars.env["lower_case"]; set {
+		t.Error("unset lower_case left the variable set")
+	}
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// suggestPrompt asks for a shell command as a structured JSON answer
+const suggestPrompt = `%s
+Return ONLY a JSON object, with no surrounding text or code fences, in exactly this format:
+{
+  "command": "the command line",
+  "summary": "one sentence on what it does",
+  "parts": [{"token": "a program, flag or argument of the command", "meaning": "what it does"}],
+  "risk": "low, medium or high",
+  "risk_reason": "why, e.g. what it deletes or overwrites",
+  "requires": ["external programs the command runs"],
+  "alternatives": [{"command": "another way to do it", "summary": "how it differs", "risk": "low, medium or high", "requires": ["programs"]}]
+}
+
+Rules:
+- Explain every program, flag and argument of "command" in "parts", in order
+- "risk", also for each alternative, is high for anything that deletes, overwrites or changes system state, low for read-only commands
+- List only executables in "requires", not shell built-ins
+- Give at most 3 alternatives; an empty list is fine`
+
+// suggestTask introduces a task for suggestPrompt
+const suggestTask = `Suggest a shell command for the following task. If it already is a
+command, complete or correct it:
+
+"%s"
+`
+
+// fixTask introduces a failed command for suggestPrompt
+const fixTask = `This shell command failed with exit status %d:
+
+%s
+
+Suggest the corrected command that does what was intended, e.g. with a typo,
+wrong flag or missing argument fixed. If the command is correct and failed
+for another reason, suggest the command that deals with that reason.
+`
+
+// commandPart explains one token of a suggested command
+type commandPart struct {
+	Token   string `json:"token"`
+	Meaning string `json:"meaning"`
+}
+
+// commandOption is a command the model suggested with what it needs to run
+// and how risky the model thinks it is
+type commandOption struct {
+	Command  string   `json:"command"`
+	Summary  string   `json:"summary"`
+	Risk     string   `json:"risk"`
+	Requires []string `json:"requires"`
+}
+
+// commandSuggestion is the model's structured answer for neurocli cmd
+type commandSuggestion struct {
+	commandOption
+	Parts        []commandPart   `json:"parts"`
+	RiskReason   string          `json:"risk_reason"`
+	Alternatives []commandOption `json:"alternatives"`
+}
+
+func newCmdCmd() *cobra.Command {
+	var (
+		run    bool
+		asJSON bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "cmd TASK",
+		Short: "Turn a task description into a shell command",
+		Long: `Ask for a shell command that does TASK. The answer explains every part of the
+command, rates its risk and offers alternatives. Programs the command needs
+are checked on PATH. In a terminal you can then pick the command or an
+alternative to run; it goes through the same execution gate as the shell,
+and commands that are high risk or found destructive always ask first.`,
+		Example: `  neurocli cmd "find large files changed this week"
+  neurocli cmd --json "count lines of Go code" | jq -r .command`,
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: cobra.NoFileCompletions,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			task := strings.Join(args, " ")
+			s, err := suggestCommand(task)
+			if err != nil {
+				return err
+			}
+
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(s)
+			}
+
+			printSuggestion(s)
+			if !run && !term.IsTerminal(int(os.Stdin.Fd())) {
+				return nil
+			}
+			return runSuggestion(s, run)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&run, "run", "r", false, "run the suggested command without picking one")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print the structured answer as JSON")
+	return cmd
+}
+
+// suggestCommand asks the model for a command that does task
+func suggestCommand(task string) (*commandSuggestion, error) {
+	return askSuggestion(fmt.Sprintf(suggestTask, task))
+}
+
+// suggestFix asks the model to correct a command that failed
+func suggestFix(command string, status int) (*commandSuggestion, error) {
+	return askSuggestion(fmt.Sprintf(fixTask, status, fenced(command)))
+}
+
+// askSuggestion asks the model for a command suggestion for a task
+// description from suggestTask or fixTask
+func askSuggestion(task string) (*commandSuggestion, error) {
+	response, err := askAI(fmt.Sprintf(suggestPrompt, task))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get a command: %w", err)
+	}
+	return parseSuggestion(response)
+}
+
+// parseSuggestion extracts the JSON answer from a model response
+func parseSuggestion(response string) (*commandSuggestion, error) {
+	start := strings.Index(response, "{")
+	end := strings.LastIndex(response, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("response does not contain a JSON answer")
+	}
+
+	var s commandSuggestion
+	if err := json.Unmarshal([]byte(response[start:end+1]), &s); err != nil {
+		return nil, fmt.Errorf("invalid command suggestion: %v", err)
+	}
+	s.Command = strings.TrimSpace(s.Command)
+	if s.Command == "" {
+		return nil, fmt.Errorf("the AI suggested no command")
+	}
+	s.Risk = strings.ToLower(strings.TrimSpace(s.Risk))
+	for i := range s.Alternatives {
+		s.Alternatives[i].Risk = strings.ToLower(strings.TrimSpace(s.Alternatives[i].Risk))
+	}
+	return &s, nil
+}
+
+// missingTools returns the required programs that aren't on PATH
+func (o commandOption) missingTools() []string {
+	var missing []string
+	for _, tool := range o.Requires {
+		if _, err := exec.LookPath(tool); err != nil {
+			missing = append(missing, tool)
+		}
+	}
+	return missing
+}
+
+// riskLabel colors a risk level
+func riskLabel(risk string) string {
+	switch risk {
+	case "low":
+		return pterm.Green(risk)
+	case "medium":
+		return pterm.Yellow(risk)
+	case "high":
+		return pterm.Red(risk)
+	}
+	return pterm.Gray("unknown")
+}
+
+// printSuggestion shows the command, what each part does, its risk and the
+// alternatives
+func printSuggestion(s *commandSuggestion) {
+	fmt.Println(pterm.Bold.Sprint(pterm.Cyan(s.Command)))
+	if s.Summary != "" {
+		fmt.Println(s.Summary)
+	}
+	fmt.Println()
+
+	if len(s.Parts) > 0 {
+		t := newShellTable("PART", "MEANING")
+		for _, p := range s.Parts {
+			t.Row(p.Token, p.Meaning)
+		}
+		fmt.Println(t.Render())
+	}
+
+	risk := "Risk: " + riskLabel(s.Risk)
+	if s.RiskReason != "" {
+		risk += " - " + s.RiskReason
+	}
+	fmt.Println(risk)
+	if len(s.Requires) > 0 {
+		fmt.Println("Requires: " + strings.Join(s.Requires, ", "))
+	}
+	if missing := s.missingTools(); len(missing) > 0 {
+		pterm.Warning.WithWriter(os.Stderr).Printf("Not found on PATH: %s\n", strings.Join(missing, ", "))
+	}
+
+	if len(s.Alternatives) > 0 {
+		fmt.Println("\nAlternatives:")
+		for i, alt := range s.Alternatives {
+			fmt.Printf("  %d. %s (risk: %s)\n", i+1, pterm.Cyan(alt.Command), riskLabel(alt.Risk))
+			if alt.Summary != "" {
+				fmt.Printf("     %s\n", alt.Summary)
+			}
+			if missing := alt.missingTools(); len(missing) > 0 {
+				fmt.Printf("     %s\n", pterm.Yellow("not found on PATH: "+strings.Join(missing, ", ")))
+			}
+		}
+	}
+	fmt.Println()
+}
+
+// runSuggestion runs the suggested command, or one the user picks from the
+// suggestion and its alternatives
+func runSuggestion(s *commandSuggestion, direct bool) error {
+	chosen := s.commandOption
+	if !direct {
+		options := []string{s.Command}
+		for _, alt := range s.Alternatives {
+			options = append(options, alt.Command)
+		}
+		const cancel = "Don't run anything"
+		choice, err := pterm.DefaultInteractiveSelect.
+			WithOptions(append(options, cancel)).
+			Show("Run")
+		if err != nil {
+			return err
+		}
+		if choice == cancel {
+			return nil
+		}
+		for _, alt := range s.Alternatives {
+			if choice == alt.Command && choice != s.Command {
+				chosen = alt
+			}
+		}
+	}
+
+	if missing := chosen.missingTools(); len(missing) > 0 {
+		return fmt.Errorf("cannot run %s: %s not found on PATH", chosen.Command, strings.Join(missing, ", "))
+	}
+
+	// The risk is the model's own claim, so the command is also checked
+	// locally; either one is enough to ask first. The gate asks itself for
+	// anything outside its allowlist, so the question is only put once.
+	warnings := chosen.warnings()
+	if chosen.Risk == "high" || len(warnings) > 0 {
+		for _, w := range warnings {
+			pterm.Warning.WithWriter(os.Stderr).Println(w)
+		}
+		if scriptAllowlisted(chosen.Command) {
+			ok, err := confirm(fmt.Sprintf("%s may be destructive. Run it?", chosen.Command))
+			if err != nil || !ok {
+				return err
+			}
+		}
+	}
+	return executeGated(chosen.Command)
+}
+
+// warnings returns what NeuroCLI itself finds destructive in the command
+func (o commandOption) warnings() []string {
+	tokens, err := parseCommandLine(o.Command)
+	if err != nil {
+		return []string{fmt.Sprintf("could not check the command: %v", err)}
+	}
+	return destructiveWarnings(tokens)
+}
+
+func newSuggestCmd() *cobra.Command {
+	var skipSecrets bool
+
+	cmd := &cobra.Command{
+		Use:   "suggest TEXT",
+		Short: "Print only the suggested command, for shell integration",
+		Long: `Turn a task description, or a partly written command, into a shell command
+and print nothing but that command. The key binding installed by
+'neurocli init' replaces the command line with this output.`,
+		Example:           `  neurocli suggest "list the ten largest files here"`,
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: cobra.NoFileCompletions,
+		SilenceUsage:      true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			task := strings.TrimSpace(strings.Join(args, " "))
+			if task == "" {
+				return fmt.Errorf("nothing to suggest a command for")
+			}
+			// Mistyped lines reach the command-not-found handler without
+			// the user asking for anything, so they are never sent when
+			// they hold a secret
+			if skipSecrets && containsSecret(task) {
+				return nil
+			}
+			s, err := suggestCommand(task)
+			if err != nil {
+				return err
+			}
+			fmt.Println(s.Command)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&skipSecrets, "skip-secrets", false, "print nothing for text that looks like it contains a secret")
+	return cmd
+}
+
+func newFixCmd() *cobra.Command {
+	var (
+		status    int
+		printOnly bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "fix [COMMAND]",
+		Short: "Suggest a corrected version of a failed command",
+		Long: `Ask for a corrected version of a command that failed and offer to run it, as
+with 'neurocli cmd'. With the shell integration ('neurocli init') loaded, a
+plain 'neurocli fix' passes the last failed command and its exit status.`,
+		Example: `  neurocli fix
+  neurocli fix "git comit -m 'add parser'"
+  neurocli fix --print --exit-status 2 "tar -xzf missing.tgz"`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			command := strings.Join(args, " ")
+			if strings.TrimSpace(command) == "" {
+				return fmt.Errorf("no command to fix; pass one, or set up the shell integration with 'neurocli init'")
+			}
+
+			s, err := suggestFix(command, status)
+			if err != nil {
+				return err
+			}
+			if printOnly {
+				fmt.Println(s.Command)
+				return nil
+			}
+
+			printSuggestion(s)
+			if !term.IsTerminal(int(os.Stdin.Fd())) {
+				return nil
+			}
+			return runSuggestion(s, false)
+		},
+	}
+
+	cmd.Flags().IntVar(&status, "exit-status", 1, "exit status the command failed with")
+	cmd.RegisterFlagCompletionFunc("exit-status", cobra.NoFileCompletions)
+	cmd.Flags().BoolVar(&printOnly, "print", false, "print only the corrected command")
+	return cmd
+}
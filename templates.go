@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// commandTemplate is a user-defined subcommand loaded from a commands directory.
+//
+// Templates are YAML files (.yaml, .yml) holding every field, or Go template
+// files (.tmpl) with the YAML fields as front matter between "---" lines and
+// the prompt template as the body:
+//
+//	---
+//	name: review
+//	description: Review the staged changes
+//	flags:
+//	  - name: focus
+//	    default: bugs
+//	    values: [bugs, style, performance]
+//	---
+//	Review this diff, focusing on {{.Flags.focus}}:
+//
+//	{{gitDiff "--cached"}}
+type commandTemplate struct {
+	Name        string         `yaml:"name"`
+	Description string         `yaml:"description"`
+	Example     string         `yaml:"example"`
+	Flags       []templateFlag `yaml:"flags"`
+	System      string         `yaml:"system"`
+	Prompt      string         `yaml:"prompt"`
+	Output      templateOutput `yaml:"output"`
+	path        string
+}
+
+// templateFlag declares a flag on a template command. Values are offered as
+// shell completions.
+type templateFlag struct {
+	Name        string   `yaml:"name"`
+	Shorthand   string   `yaml:"shorthand"`
+	Description string   `yaml:"description"`
+	Default     string   `yaml:"default"`
+	Type        string   `yaml:"type"`
+	Values      []string `yaml:"values"`
+}
+
+// templateOutput controls what happens with the model's response. Mode is
+// "print" (default) or "file"; with Code set only the code is kept.
+type templateOutput struct {
+	Mode string `yaml:"mode"`
+	File string `yaml:"file"`
+	Code bool   `yaml:"code"`
+}
+
+// templateData is the value the prompt and output path templates are executed with
+type templateData struct {
+	Args  []string
+	Input string
+	Flags map[string]string
+}
+
+// templateDirs returns the user and project command directories, in the order
+// they are loaded; later directories override earlier ones
+func templateDirs() []string {
+	var dirs []string
+	if dir, err := configDir(); err == nil {
+		dirs = append(dirs, filepath.Join(dir, "commands"))
+	}
+	return append(dirs, filepath.Join(".neurocli", "commands"))
+}
+
+// loadTemplates reads every template in the command directories, keyed by name
+func loadTemplates() (map[string]*commandTemplate, error) {
+	templates := make(map[string]*commandTemplate)
+
+	for _, dir := range templateDirs() {
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", dir, err)
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			tmpl, err := parseTemplateFile(path)
+			if err != nil {
+				pterm.Warning.WithWriter(os.Stderr).Printf("Skipping command template %s: %v\n", path, err)
+				continue
+			}
+			if tmpl != nil {
+				templates[tmpl.Name] = tmpl
+			}
+		}
+	}
+
+	return templates, nil
+}
+
+// parseTemplateFile parses a .yaml, .yml or .tmpl command file. Other files
+// are ignored and return nil.
+func parseTemplateFile(path string) (*commandTemplate, error) {
+	ext := filepath.Ext(path)
+	if ext != ".yaml" && ext != ".yml" && ext != ".tmpl" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tmpl commandTemplate
+	if ext == ".tmpl" {
+		front, body, err := splitFrontMatter(string(data))
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal([]byte(front), &tmpl); err != nil {
+			return nil, fmt.Errorf("invalid front matter: %v", err)
+		}
+		tmpl.Prompt = body
+	} else if err := yaml.Unmarshal(data, &tmpl); err != nil {
+		return nil, fmt.Errorf("invalid YAML: %v", err)
+	}
+
+	if tmpl.Name == "" {
+		tmpl.Name = strings.TrimSuffix(filepath.Base(path), ext)
+	}
+	if strings.TrimSpace(tmpl.Prompt) == "" {
+		return nil, fmt.Errorf("no prompt template")
+	}
+	switch tmpl.Output.Mode {
+	case "", "print":
+	case "file":
+		if tmpl.Output.File == "" {
+			return nil, fmt.Errorf("output mode file needs an output file template")
+		}
+	default:
+		return nil, fmt.Errorf("unknown output mode %q", tmpl.Output.Mode)
+	}
+
+	tmpl.path = path
+	return &tmpl, nil
+}
+
+// splitFrontMatter separates a leading "---" delimited YAML block from the body
+func splitFrontMatter(content string) (string, string, error) {
+	content = strings.TrimPrefix(content, "\ufeff")
+	if !strings.HasPrefix(content, "---") {
+		return "", content, nil
+	}
+
+	rest := strings.TrimLeft(content[3:], " \t")
+	rest = strings.TrimPrefix(strings.TrimPrefix(rest, "\r"), "\n")
+	end := strings.Index(rest, "\n---")
+	if end < 0 {
+		return "", "", fmt.Errorf("unterminated front matter")
+	}
+
+	body := rest[end+4:]
+	if i := strings.IndexByte(body, '\n'); i >= 0 {
+		body = body[i+1:]
+	} else {
+		body = ""
+	}
+	return rest[:end], body, nil
+}
+
+// registerTemplateCommands adds a subcommand for every user template that
+// doesn't clash with a built-in command
+func registerTemplateCommands(root *cobra.Command) {
+	templates, err := loadTemplates()
+	if err != nil {
+		pterm.Warning.WithWriter(os.Stderr).Println(err)
+		return
+	}
+
+	names := make([]string, 0, len(templates))
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		tmpl := templates[name]
+		if existing, _, err := root.Find([]string{name}); (err == nil && existing != root) || name == "help" || name == "completion" {
+			pterm.Warning.WithWriter(os.Stderr).Printf("Command template %s shadows the built-in %q command; ignoring it\n", tmpl.path, name)
+			continue
+		}
+		root.AddCommand(newTemplateCmd(tmpl))
+	}
+}
+
+func newTemplateCmd(tmpl *commandTemplate) *cobra.Command {
+	flagValues := make(map[string]*string)
+	boolValues := make(map[string]*bool)
+
+	cmd := &cobra.Command{
+		Use:     tmpl.Name + " [input]",
+		Short:   tmpl.Description,
+		Long:    strings.TrimSpace(tmpl.Description + "\n\nDefined in " + tmpl.path),
+		Example: tmpl.Example,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data := templateData{
+				Args:  args,
+				Input: strings.Join(args, " "),
+				Flags: make(map[string]string),
+			}
+			for name, v := range flagValues {
+				data.Flags[name] = *v
+			}
+			for name, v := range boolValues {
+				data.Flags[name] = fmt.Sprint(*v)
+			}
+
+			prompt, err := renderTemplate(tmpl.Name, tmpl.Prompt, data)
+			if err != nil {
+				return err
+			}
+			system := withEnvironment(tmpl.System)
+			if tmpl.System == "" {
+				if system, err = activeSystemPrompt(); err != nil {
+					return err
+				}
+			}
+
+			response, err := askAIWithSystem(system, prompt)
+			if err != nil {
+				return err
+			}
+			if tmpl.Output.Code {
+				response = extractCode(response, "")
+			}
+
+			if tmpl.Output.Mode != "file" {
+				if tmpl.Output.Code {
+					fmt.Println(response)
+				} else {
+					printMarkdown(response)
+				}
+				return nil
+			}
+
+			path, err := renderTemplate(tmpl.Name+" output", tmpl.Output.File, data)
+			if err != nil {
+				return err
+			}
+			path = strings.TrimSpace(path)
+			if path == "" {
+				return fmt.Errorf("output file template rendered an empty path")
+			}
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return fmt.Errorf("failed to create directory: %w", err)
+			}
+			if err := os.WriteFile(path, []byte(response), 0644); err != nil {
+				return fmt.Errorf("failed to write file: %w", err)
+			}
+			pterm.Success.Printf("✓ Wrote %s\n", pterm.Green(path))
+			return nil
+		},
+	}
+
+	for _, f := range tmpl.Flags {
+		if f.Type == "bool" {
+			boolValues[f.Name] = cmd.Flags().BoolP(f.Name, f.Shorthand, f.Default == "true", f.Description)
+			continue
+		}
+		flagValues[f.Name] = cmd.Flags().StringP(f.Name, f.Shorthand, f.Default, f.Description)
+		if len(f.Values) > 0 {
+			values := f.Values
+			cmd.RegisterFlagCompletionFunc(f.Name, func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+				return values, cobra.ShellCompDirectiveNoFileComp
+			})
+		}
+	}
+
+	return cmd
+}
+
+// renderTemplate executes a prompt template with the helper functions:
+//
+//	stdin            piped standard input (empty when stdin is a terminal)
+//	file "path"      contents of a file
+//	gitDiff args...  output of git diff with the given arguments
+//	cwd              current working directory
+//	env "NAME"       an environment variable
+func renderTemplate(name, text string, data templateData) (string, error) {
+	t, err := template.New(name).Funcs(templateFuncs()).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid template %s: %v", name, err)
+	}
+
+	var out bytes.Buffer
+	if err := t.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to render template %s: %v", name, err)
+	}
+	return out.String(), nil
+}
+
+var readStdinOnce = sync.OnceValues(func() (string, error) {
+	info, err := os.Stdin.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice != 0 {
+		return "", nil
+	}
+	data, err := io.ReadAll(os.Stdin)
+	return string(data), err
+})
+
+func templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"stdin": readStdinOnce,
+		"file": func(path string) (string, error) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return "", fmt.Errorf("failed to read %s: %v", path, err)
+			}
+			return string(data), nil
+		},
+		"gitDiff": func(args ...string) (string, error) {
+			out, err := exec.Command("git", append([]string{"diff"}, args...)...).Output()
+			if err != nil {
+				return "", fmt.Errorf("failed to get git diff: %v", err)
+			}
+			return string(out), nil
+		},
+		"cwd":  os.Getwd,
+		"env":  os.Getenv,
+		"trim": strings.TrimSpace,
+	}
+}
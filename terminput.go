@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/peterh/liner"
+	"golang.org/x/term"
+)
+
+// Bracketed paste wraps pasted text in these markers once enabled
+const (
+	pasteOn    = "\x1b[?2004h"
+	pasteOff   = "\x1b[?2004l"
+	pasteStart = "\x1b[200~"
+	pasteEnd   = "\x1b[201~"
+)
+
+// Keys the filter reacts to
+const (
+	keyCtrlC = 0x03
+	keyCtrlE = 0x05
+	keyCtrlR = 0x12
+	keyCtrlX = 0x18
+	keyEsc   = 0x1b
+)
+
+// lineEnd is the key a prompt line was ended with
+type lineEnd int
+
+const (
+	endEnter  lineEnd = iota
+	endEdit           // Ctrl-X Ctrl-E, to open the line in the editor
+	endSearch         // Ctrl-R, to search the history for the line
+)
+
+// terminalInput sits between the terminal and liner, which reads a pipe
+// instead of stdin. It turns a bracketed paste into one piece of input and
+// catches Ctrl-X Ctrl-E and Ctrl-R, which liner doesn't support or only
+// supports as a plain substring search. The terminal is
+// only read while a prompt is shown, so commands run from the shell get
+// their input untouched.
+type terminalInput struct {
+	tty  *bufio.Reader
+	pipe *os.File
+	wake chan struct{}
+
+	mu     sync.Mutex
+	armed  bool
+	end    lineEnd
+	pastes map[string]string
+}
+
+// shellInput filters the shell's terminal input; nil when liner reads stdin
+// directly
+var shellInput *terminalInput
+
+// newShellLiner creates the shell's liner instance, reading through
+// shellInput where the platform allows it
+func newShellLiner() *liner.State {
+	// liner reads the console directly on Windows
+	if runtime.GOOS == "windows" || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return liner.NewLiner()
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return liner.NewLiner()
+	}
+
+	// liner takes its reader from os.Stdin when it is created; the
+	// terminal modes are still set on the real stdin
+	stdin := os.Stdin
+	os.Stdin = r
+	line := liner.NewLiner()
+	os.Stdin = stdin
+
+	shellInput = &terminalInput{
+		tty:    bufio.NewReader(stdin),
+		pipe:   w,
+		wake:   make(chan struct{}, 1),
+		pastes: make(map[string]string),
+	}
+	go shellInput.run()
+	return line
+}
+
+// arm starts forwarding terminal input for a prompt
+func (t *terminalInput) arm() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.end = endEnter
+	if !t.armed {
+		t.armed = true
+		t.wake <- struct{}{}
+	}
+	fmt.Print(pasteOn)
+}
+
+// done ends a prompt and reports how the line was ended
+func (t *terminalInput) done() lineEnd {
+	if t == nil {
+		return endEnter
+	}
+	fmt.Print(pasteOff)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.end
+}
+
+// run forwards the terminal to liner's pipe whenever a prompt is armed. It
+// stops after the key that ends a line, as liner's own reader does.
+func (t *terminalInput) run() {
+	for range t.wake {
+		for {
+			b, err := t.tty.ReadByte()
+			if err != nil {
+				t.pipe.Close()
+				return
+			}
+			if t.forward(b) {
+				break
+			}
+		}
+	}
+}
+
+// endLine forwards the key that ends the line. The prompt is disarmed
+// first: once liner has the key the next prompt may arm right away, and it
+// must then wake run again.
+func (t *terminalInput) endLine(key byte, end lineEnd) {
+	t.mu.Lock()
+	t.armed = false
+	t.end = end
+	t.mu.Unlock()
+	t.pipe.Write([]byte{key})
+}
+
+// forward handles one byte read from the terminal and reports whether it
+// ended the line
+func (t *terminalInput) forward(b byte) bool {
+	switch b {
+	case keyEsc:
+		// A terminal sends the whole marker at once, so a lone Escape key
+		// isn't held up waiting for more input
+		if t.tty.Buffered() >= len(pasteStart)-1 {
+			if next, _ := t.tty.Peek(len(pasteStart) - 1); string(next) == pasteStart[1:] {
+				t.tty.Discard(len(next))
+				t.paste()
+				return false
+			}
+		}
+	case keyCtrlX:
+		next, err := t.tty.ReadByte()
+		if err == nil && next == keyCtrlE {
+			t.endLine('\r', endEdit)
+			return true
+		}
+		t.pipe.Write([]byte{b})
+		if err != nil {
+			return false
+		}
+		return t.forward(next)
+	case keyCtrlR:
+		t.endLine('\r', endSearch)
+		return true
+	case '\r', '\n', keyCtrlC:
+		t.endLine(b, endEnter)
+		return true
+	}
+	t.pipe.Write([]byte{b})
+	return false
+}
+
+// paste reads a bracketed paste. Text liner can't hold on one line is kept
+// aside and a placeholder is inserted, which readInput expands again.
+func (t *terminalInput) paste() {
+	var buf []byte
+	for !bytes.HasSuffix(buf, []byte(pasteEnd)) {
+		b, err := t.tty.ReadByte()
+		if err != nil {
+			break
+		}
+		buf = append(buf, b)
+	}
+	text := strings.TrimSuffix(string(buf), pasteEnd)
+	text = strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\r", "\n")
+	if !strings.ContainsAny(text, "\n\t") {
+		t.pipe.Write([]byte(text))
+		return
+	}
+
+	t.mu.Lock()
+	lines := strings.Count(strings.TrimSuffix(text, "\n"), "\n") + 1
+	unit := "lines"
+	if lines == 1 {
+		unit = "line"
+	}
+	placeholder := fmt.Sprintf("[paste #%d, %d %s]", len(t.pastes)+1, lines, unit)
+	t.pastes[placeholder] = text
+	t.mu.Unlock()
+	t.pipe.Write([]byte(placeholder))
+}
+
+// expandPastes replaces paste placeholders in input with the pasted text
+func (t *terminalInput) expandPastes(input string) string {
+	if t == nil {
+		return input
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for placeholder, text := range t.pastes {
+		input = strings.ReplaceAll(input, placeholder, text)
+	}
+	return input
+}
+
+// clearPastes forgets the pastes of the previous input
+func (t *terminalInput) clearPastes() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	clear(t.pastes)
+}
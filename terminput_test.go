@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestInput returns a terminalInput reading input, and the pipe liner
+// would read from
+func newTestInput(t *testing.T, input string) (*terminalInput, *bufio.Reader) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close(); w.Close() })
+	in := &terminalInput{
+		tty:    bufio.NewReader(strings.NewReader(input)),
+		pipe:   w,
+		wake:   make(chan struct{}, 1),
+		pastes: make(map[string]string),
+	}
+	go in.run()
+	return in, bufio.NewReader(r)
+}
+
+// readLine reads what liner would get for one prompt
+func readLine(t *testing.T, in *terminalInput, out *bufio.Reader) (string, lineEnd) {
+	t.Helper()
+	done := make(chan string, 1)
+	go func() {
+		line, _ := out.ReadString('\r')
+		done <- line
+	}()
+	select {
+	case line := <-done:
+		// The next prompt may arm right away, so the filter must already
+		// be disarmed once liner has the line
+		in.mu.Lock()
+		armed := in.armed
+		in.mu.Unlock()
+		if armed {
+			t.Fatal("still armed after the line ended")
+		}
+		return strings.TrimSuffix(line, "\r"), in.done()
+	case <-time.After(2 * time.Second):
+		t.Fatal("prompt got no input")
+		return "", endEnter
+	}
+}
+
+func TestTerminalInputArmsEveryPrompt(t *testing.T) {
+	silenceStdout(t)
+	in, out := newTestInput(t, strings.Repeat("ls\r", 200))
+
+	// The next prompt arms as soon as the previous line ended
+	for i := 0; i < 200; i++ {
+		in.arm()
+		if line, _ := readLine(t, in, out); line != "ls" {
+			t.Fatalf("prompt %d got %q", i, line)
+		}
+	}
+}
+
+func TestTerminalInputPasteEditAndSearch(t *testing.T) {
+	silenceStdout(t)
+	in, out := newTestInput(t, "!echo "+pasteStart+"one\r\ntwo"+pasteEnd+"\r"+"fix this\x18\x05"+"git\x12"+pasteStart+"single"+pasteEnd+"\r")
+
+	in.arm()
+	line, end := readLine(t, in, out)
+	if end != endEnter || line != "!echo [paste #1, 2 lines]" {
+		t.Fatalf("got %q, end %v", line, end)
+	}
+	if got := in.expandPastes(line); got != "!echo one\ntwo" {
+		t.Errorf("expanded to %q", got)
+	}
+
+	in.arm()
+	if line, end := readLine(t, in, out); end != endEdit || line != "fix this" {
+		t.Errorf("Ctrl-X Ctrl-E: got %q, end %v", line, end)
+	}
+
+	in.arm()
+	if line, end := readLine(t, in, out); end != endSearch || line != "git" {
+		t.Errorf("Ctrl-R: got %q, end %v", line, end)
+	}
+
+	in.clearPastes()
+	in.arm()
+	if line, _ := readLine(t, in, out); line != "single" {
+		t.Errorf("single-line paste: got %q", line)
+	}
+}
+
+// silenceStdout discards the bracketed paste switches arm and done print
+func silenceStdout(t *testing.T) {
+	t.Helper()
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = devNull
+	t.Cleanup(func() {
+		os.Stdout = stdout
+		devNull.Close()
+	})
+}
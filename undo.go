@@ -0,0 +1,243 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// maxUndoEntries is how many journal entries are kept before the oldest are pruned
+const maxUndoEntries = 20
+
+// undoEntry records the files touched by one change so it can be reverted
+type undoEntry struct {
+	Time        time.Time  `json:"time"`
+	Description string     `json:"description"`
+	Files       []undoFile `json:"files"`
+	dir         string
+}
+
+// undoFile is one file in an undo entry. Backup names the copy of the
+// original inside the entry directory; it is empty for files that were created.
+type undoFile struct {
+	Path      string `json:"path"`
+	Backup    string `json:"backup,omitempty"`
+	AfterHash string `json:"after_hash"`
+}
+
+// undoDir returns the directory holding the undo journal
+func undoDir() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "undo"), nil
+}
+
+// writeWithJournal backs up the files about to change, records an undo entry
+// and then writes the new contents atomically. Keys of changes are file paths.
+func writeWithJournal(description string, changes map[string]string) error {
+	root, err := undoDir()
+	if err != nil {
+		return err
+	}
+
+	contents := make(map[string]string, len(changes))
+	paths := make([]string, 0, len(changes))
+	for path, content := range changes {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		contents[abs] = content
+		paths = append(paths, abs)
+	}
+	sort.Strings(paths)
+
+	entry := undoEntry{
+		Time:        time.Now(),
+		Description: description,
+		dir:         filepath.Join(root, time.Now().Format("20060102-150405.000000000")),
+	}
+	if err := os.MkdirAll(entry.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create undo journal: %v", err)
+	}
+
+	for i, path := range paths {
+		f := undoFile{Path: path, AfterHash: hashContent(contents[path])}
+		original, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			f.Backup = fmt.Sprintf("%d-%s", i, filepath.Base(path))
+			if err := os.WriteFile(filepath.Join(entry.dir, f.Backup), original, 0600); err != nil {
+				os.RemoveAll(entry.dir)
+				return fmt.Errorf("failed to back up %s: %v", path, err)
+			}
+		case !errors.Is(err, os.ErrNotExist):
+			os.RemoveAll(entry.dir)
+			return fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		entry.Files = append(entry.Files, f)
+	}
+
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		os.RemoveAll(entry.dir)
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(entry.dir, "journal.json"), data, 0600); err != nil {
+		os.RemoveAll(entry.dir)
+		return fmt.Errorf("failed to write undo journal: %v", err)
+	}
+
+	if err := writeFilesAtomically("", paths, contents); err != nil {
+		os.RemoveAll(entry.dir)
+		return err
+	}
+
+	pruneUndoJournal(root)
+	return nil
+}
+
+// loadUndoEntries returns the journal entries, newest first
+func loadUndoEntries() ([]*undoEntry, error) {
+	root, err := undoDir()
+	if err != nil {
+		return nil, err
+	}
+	dirs, err := os.ReadDir(root)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read undo journal: %v", err)
+	}
+
+	var entries []*undoEntry
+	for i := len(dirs) - 1; i >= 0; i-- {
+		dir := filepath.Join(root, dirs[i].Name())
+		data, err := os.ReadFile(filepath.Join(dir, "journal.json"))
+		if err != nil {
+			continue
+		}
+		var entry undoEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			continue
+		}
+		entry.dir = dir
+		entries = append(entries, &entry)
+	}
+	return entries, nil
+}
+
+// pruneUndoJournal drops the oldest entries beyond maxUndoEntries
+func pruneUndoJournal(root string) {
+	dirs, err := os.ReadDir(root)
+	if err != nil {
+		return
+	}
+	for i := 0; i < len(dirs)-maxUndoEntries; i++ {
+		os.RemoveAll(filepath.Join(root, dirs[i].Name()))
+	}
+}
+
+// revert restores every file in the entry to its state before the change.
+// Files modified since then are only overwritten with force.
+func (e *undoEntry) revert(force bool) error {
+	var modified []string
+	for _, f := range e.Files {
+		current, err := os.ReadFile(f.Path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to read %s: %v", f.Path, err)
+		}
+		if err != nil || hashContent(string(current)) != f.AfterHash {
+			modified = append(modified, f.Path)
+		}
+	}
+	if len(modified) > 0 && !force {
+		return fmt.Errorf("files changed since the edit, rerun with --force to revert anyway: %s", strings.Join(modified, ", "))
+	}
+
+	restore := make(map[string]string)
+	var restorePaths []string
+	for _, f := range e.Files {
+		if f.Backup == "" {
+			if err := os.Remove(f.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("failed to remove %s: %v", f.Path, err)
+			}
+			continue
+		}
+		original, err := os.ReadFile(filepath.Join(e.dir, f.Backup))
+		if err != nil {
+			return fmt.Errorf("failed to read backup of %s: %v", f.Path, err)
+		}
+		restore[f.Path] = string(original)
+		restorePaths = append(restorePaths, f.Path)
+	}
+
+	if err := writeFilesAtomically("", restorePaths, restore); err != nil {
+		return err
+	}
+	return os.RemoveAll(e.dir)
+}
+
+func hashContent(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func newUndoCmd() *cobra.Command {
+	var list, force bool
+
+	cmd := &cobra.Command{
+		Use:   "undo",
+		Short: "Revert the most recent AI edit",
+		Long: `Revert the most recent change made by 'neurocli edit', restoring the
+original contents of every file it touched. Each undo steps one entry further
+back in the journal.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entries, err := loadUndoEntries()
+			if err != nil {
+				return err
+			}
+			if len(entries) == 0 {
+				pterm.Info.Println("Nothing to undo")
+				return nil
+			}
+
+			if list {
+				data := pterm.TableData{{"WHEN", "CHANGE", "FILES"}}
+				for _, e := range entries {
+					var names []string
+					for _, f := range e.Files {
+						names = append(names, f.Path)
+					}
+					data = append(data, []string{e.Time.Format("2006-01-02 15:04:05"), e.Description, strings.Join(names, ", ")})
+				}
+				return pterm.DefaultTable.WithHasHeader().WithData(data).Render()
+			}
+
+			entry := entries[0]
+			if err := entry.revert(force); err != nil {
+				return err
+			}
+			pterm.Success.Printf("✓ Reverted %q (%d file(s))\n", entry.Description, len(entry.Files))
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&list, "list", false, "List the undo journal instead of reverting")
+	cmd.Flags().BoolVar(&force, "force", false, "Revert even if files changed after the edit")
+	return cmd
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pterm/pterm"
+)
+
+// repairPrompt feeds checker output back to the model
+const repairPrompt = `The following %s code was generated for this description:
+
+"%s"
+
+It fails to build with these errors:
+
+%s
+
+Code:
+
+%s
+
+Fix the errors while keeping the intended behavior. Return only the complete corrected code without any explanations.`
+
+// codeVerifier checks generated code with a local toolchain. Each step is a
+// command run in a scratch directory holding the code in File; "{file}" in a
+// step is replaced by the file name. Setup steps may fail without failing
+// verification (e.g. go mod tidy without network access).
+type codeVerifier struct {
+	File  string
+	Setup [][]string
+	Steps [][]string
+}
+
+// errNoVerifier is returned when a language has no checker or its tools are missing
+var errNoVerifier = errors.New("no verifier available")
+
+// verifyCode runs the language's checker over code and returns its combined
+// output along with whether every step passed
+func verifyCode(language, code string) (string, bool, error) {
+	lang, ok := lookupLanguage(language)
+	if !ok || lang.Verifier == nil {
+		return "", false, fmt.Errorf("%w for %s", errNoVerifier, language)
+	}
+	v := lang.Verifier
+	for _, step := range append(v.Setup, v.Steps...) {
+		if _, err := lookTool(step[0]); err != nil {
+			return "", false, fmt.Errorf("%w for %s: %s is not installed", errNoVerifier, language, step[0])
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "neurocli-verify-*")
+	if err != nil {
+		return "", false, err
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.WriteFile(filepath.Join(dir, v.File), []byte(code), 0644); err != nil {
+		return "", false, err
+	}
+
+	for _, step := range v.Setup {
+		runVerifierStep(dir, v.File, step)
+	}
+	for _, step := range v.Steps {
+		out, err := runVerifierStep(dir, v.File, step)
+		if err != nil {
+			return strings.TrimSpace(out), false, nil
+		}
+	}
+	return "", true, nil
+}
+
+// runVerifierStep runs one checker command in dir and returns its output
+func runVerifierStep(dir, file string, step []string) (string, error) {
+	path, err := lookTool(step[0])
+	if err != nil {
+		return "", err
+	}
+	args := make([]string, len(step)-1)
+	for i, arg := range step[1:] {
+		args[i] = strings.ReplaceAll(arg, "{file}", file)
+	}
+
+	cmd := exec.Command(path, args...)
+	cmd.Dir = dir
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err = cmd.Run()
+	return out.String(), err
+}
+
+// toolAliases lists other names a tool may be installed under
+var toolAliases = map[string][]string{
+	"python3": {"python"},
+}
+
+// lookTool finds a tool on PATH, trying its aliases if needed
+func lookTool(name string) (string, error) {
+	path, err := exec.LookPath(name)
+	if err == nil {
+		return path, nil
+	}
+	for _, alias := range toolAliases[name] {
+		if path, aliasErr := exec.LookPath(alias); aliasErr == nil {
+			return path, nil
+		}
+	}
+	return "", err
+}
+
+// verifyAndRepair checks generated code and asks the model to fix reported
+// errors until it builds or maxAttempts checks have run. It returns the final
+// code and whether it passed.
+func verifyAndRepair(language, description, code string, maxAttempts int) (string, bool, error) {
+	for attempt := 1; ; attempt++ {
+		spinner, _ := pterm.DefaultSpinner.Start(fmt.Sprintf("Verifying %s code (attempt %d/%d)...", language, attempt, maxAttempts))
+		output, ok, err := verifyCode(language, code)
+		spinner.Stop()
+		if err != nil {
+			return code, false, err
+		}
+		if ok {
+			pterm.Success.Printf("✓ Code builds cleanly after %d attempt(s)\n", attempt)
+			return code, true, nil
+		}
+
+		pterm.Warning.Printf("Verification failed (attempt %d/%d):\n%s\n", attempt, maxAttempts, output)
+		if attempt >= maxAttempts {
+			return code, false, nil
+		}
+
+		response, err := askAI(fmt.Sprintf(repairPrompt, language, description, output, code))
+		if err != nil {
+			return code, false, fmt.Errorf("failed to repair code: %w", err)
+		}
+		code = extractCode(response, language)
+	}
+}